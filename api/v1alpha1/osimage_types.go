@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,42 +26,268 @@ type OSImageSpec struct {
 	WindowsISOPath string `json:"windowsISOPath"`
 	VMToolsPath    string `json:"vmtoolsPath"`
 
-	// +kubebuilder:default=dc0
+	// KubernetesVersion is the Kubernetes semver installed in the image, it selects
+	// the windows-resource-bundle image and the containerd artifacts.
+	// +kubebuilder:default=v1.23.8
 	// +kubebuilder:validation:Optional
-	VsphereDatacenter string `json:"vsphereDatacenter"`
+	// +kubebuilder:validation:Pattern=`^v[0-9]+\.[0-9]+\.[0-9]+$`
+	KubernetesVersion string `json:"kubernetesVersion"`
 
-	// +kubebuilder:default=folder0
+	// WindowsVersion is the Windows Server release, it selects the image-builder target.
+	// +kubebuilder:default="2019"
 	// +kubebuilder:validation:Optional
-	VSphereFolder string `json:"vsphereFolder"`
+	// +kubebuilder:validation:Enum="2019";"2022"
+	WindowsVersion string `json:"windowsVersion"`
 
-	// +kubebuilder:default=sharedVmfs-0
+	// WindowsEdition selects the Core or Desktop Experience image inside the ISO.
+	// +kubebuilder:default=core
 	// +kubebuilder:validation:Optional
-	VSphereDataStore string `json:"vsphereDatastore"`
+	// +kubebuilder:validation:Enum=core;desktop
+	WindowsEdition string `json:"windowsEdition"`
 
-	// +kubebuilder:default=VM Network
+	// VSphereServer is the vCenter of the build, it must be listed in vsphere-cloud-config
+	// or match the credentials Secret server. Defaults to the first vCenter.
 	// +kubebuilder:validation:Optional
-	VSphereNetwork string `json:"vsphereNetwork"`
+	VSphereServer string `json:"vsphereServer,omitempty"`
 
-	// +kubebuilder:default=rp0
+	// VsphereDatacenter is the datacenter path, defaults to the vsphere.conf datacenter.
 	// +kubebuilder:validation:Optional
-	VSphereResourcePool string `json:"vsphereResourcePool"`
+	VsphereDatacenter string `json:"vsphereDatacenter,omitempty"`
 
-	// +kubebuilder:default=cluster0
+	// VSphereFolder is the folder of the template, defaults to the datacenter VM folder.
 	// +kubebuilder:validation:Optional
-	VSphereCluster string `json:"vsphereCluster"`
+	VSphereFolder string `json:"vsphereFolder,omitempty"`
+
+	// VSphereDataStore hosts the ISOs and the template, defaults to the datastore with
+	// the most free space.
+	// +kubebuilder:validation:Optional
+	VSphereDataStore string `json:"vsphereDatastore,omitempty"`
+
+	// VSphereNetwork is the network of the Packer VM, defaults to the network used by
+	// the management cluster nodes.
+	// +kubebuilder:validation:Optional
+	VSphereNetwork string `json:"vsphereNetwork,omitempty"`
+
+	// VSphereResourcePool is the resource pool of the Packer VM, defaults to the
+	// cluster root resource pool.
+	// +kubebuilder:validation:Optional
+	VSphereResourcePool string `json:"vsphereResourcePool,omitempty"`
+
+	// VSphereCluster is the compute cluster of the Packer VM, defaults to the cluster
+	// running the management cluster nodes.
+	// +kubebuilder:validation:Optional
+	VSphereCluster string `json:"vsphereCluster,omitempty"`
+
+	// CredentialsRef is a Secret in the OSImage namespace with the vSphere server,
+	// username, password and optional thumbprint and datacenter keys. The controller
+	// default credentials are used when omitted.
+	// +kubebuilder:validation:Optional
+	CredentialsRef *corev1.LocalObjectReference `json:"credentialsRef,omitempty"`
+
+	// PackerVariablesRef is a ConfigMap in the OSImage namespace with packer
+	// variables merged into the rendered windows.json. The OSImage fails while it
+	// sets a variable reserved by the controller.
+	// +kubebuilder:validation:Optional
+	PackerVariablesRef *corev1.LocalObjectReference `json:"packerVariablesRef,omitempty"`
+
+	// PackerVariables are merged last into the rendered windows.json, overriding
+	// the controller defaults, the discovered values and the PackerVariablesRef data.
+	// The build_name, vcenter_server, username and password variables are reserved
+	// and rejected.
+	// +kubebuilder:validation:Optional
+	PackerVariables map[string]string `json:"packerVariables,omitempty"`
+
+	// ResourceBundleAddress selects how the Packer VM reaches the resource bundle.
+	// +kubebuilder:validation:Optional
+	ResourceBundleAddress *ResourceBundleAddress `json:"resourceBundleAddress,omitempty"`
+
+	// AdditionalTargets build the same template in other vCenters or datacenters,
+	// each target is built by an OSImage owned by this one.
+	// +kubebuilder:validation:Optional
+	AdditionalTargets []VSphereTarget `json:"additionalTargets,omitempty"`
+
+	// BuildHistoryLimit is the number of OSImageBuild records kept, the latest
+	// successful build is never pruned.
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Optional
+	BuildHistoryLimit *int32 `json:"buildHistoryLimit,omitempty"`
+
+	// TemplateResyncInterval is the period between two listings of the vSphere templates,
+	// defaults to the controller --template-resync-interval flag. Zero disables the resync.
+	// +kubebuilder:validation:Optional
+	TemplateResyncInterval *metav1.Duration `json:"templateResyncInterval,omitempty"`
+}
+
+// VSphereTarget is a vCenter datacenter receiving the template, the omitted
+// placement fields are resolved from the target inventory.
+type VSphereTarget struct {
+	// Server is the vCenter address
+	Server string `json:"server"`
+
+	// Datacenter is the datacenter path, defaults to the vCenter datacenter in vsphere.conf
+	// +kubebuilder:validation:Optional
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Folder string `json:"folder,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Datastore string `json:"datastore,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Network string `json:"network,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	ResourcePool string `json:"resourcePool,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	Cluster string `json:"cluster,omitempty"`
+
+	// CredentialsRef is a credentials Secret for the vCenter, defaults to the OSImage credentials.
+	// +kubebuilder:validation:Optional
+	CredentialsRef *corev1.LocalObjectReference `json:"credentialsRef,omitempty"`
+}
+
+// ResourceBundleAddressStrategy is the resolution strategy of the resource bundle URL
+// +kubebuilder:validation:Enum=NodePort;LoadBalancer;Override
+type ResourceBundleAddressStrategy string
+
+const (
+	// AddressNodePort uses a node InternalIP and the Service NodePort
+	AddressNodePort ResourceBundleAddressStrategy = "NodePort"
+	// AddressLoadBalancer uses the Service LoadBalancer ingress
+	AddressLoadBalancer ResourceBundleAddressStrategy = "LoadBalancer"
+	// AddressOverride uses the URL set on the spec
+	AddressOverride ResourceBundleAddressStrategy = "Override"
+)
+
+// ResourceBundleAddress defines the resource bundle URL reachable from the Packer VM,
+// the VM runs in vSphere and can not resolve the cluster DNS.
+type ResourceBundleAddress struct {
+	// Strategy resolves the resource bundle URL
+	// +kubebuilder:default=NodePort
+	// +kubebuilder:validation:Optional
+	Strategy ResourceBundleAddressStrategy `json:"strategy,omitempty"`
+
+	// URL is the resource bundle base URL used by the Override strategy, ie http://10.0.0.10:3000
+	// +kubebuilder:validation:Optional
+	URL string `json:"url,omitempty"`
+}
+
+// OSImagePhase is the lifecycle phase of the image build
+// +kubebuilder:validation:Enum=Pending;Preparing;Building;Publishing;Succeeded;Failed
+type OSImagePhase string
+
+const (
+	// PhasePending waits for the credentials and build inputs
+	PhasePending OSImagePhase = "Pending"
+	// PhasePreparing waits for the resource bundle and the build Job
+	PhasePreparing OSImagePhase = "Preparing"
+	// PhaseBuilding has the image-builder Job running
+	PhaseBuilding OSImagePhase = "Building"
+	// PhasePublishing waits for the template to show up in vSphere
+	PhasePublishing OSImagePhase = "Publishing"
+	// PhaseSucceeded has the template available in vSphere
+	PhaseSucceeded OSImagePhase = "Succeeded"
+	// PhaseFailed has a build that can not progress without a spec change
+	PhaseFailed OSImagePhase = "Failed"
+)
+
+// Condition types set on OSImageStatus
+const (
+	ConditionOperatorDegraded    = "OperatorDegraded"
+	ConditionCredentialsResolved = "CredentialsResolved"
+	ConditionResourceBundleReady = "ResourceBundleReady"
+	ConditionBuildJobRunning     = "BuildJobRunning"
+	ConditionTemplateAvailable   = "TemplateAvailable"
+	ConditionPreflightFailed     = "PreflightFailed"
+	ConditionBuildFailed         = "BuildFailed"
+	ConditionPlacementResolved   = "PlacementResolved"
+	ConditionTargetsReady        = "TargetsReady"
+)
+
+// OSImagePlacement holds the vSphere inventory paths used by the build
+type OSImagePlacement struct {
+	Server       string `json:"server,omitempty"`
+	Datacenter   string `json:"datacenter,omitempty"`
+	Folder       string `json:"folder,omitempty"`
+	Datastore    string `json:"datastore,omitempty"`
+	Network      string `json:"network,omitempty"`
+	ResourcePool string `json:"resourcePool,omitempty"`
+	Cluster      string `json:"cluster,omitempty"`
 }
 
 // OSImageStatus defines the observed state of OSImage
 type OSImageStatus struct {
+	// Phase is the lifecycle phase of the image build
+	Phase OSImagePhase `json:"phase,omitempty"`
+
+	// ObservedGeneration is the last spec generation reconciled by the controller
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// BuildHash is the hash of the build inputs of the current build
+	BuildHash string `json:"buildHash,omitempty"`
+
+	// BuildNumber is incremented every time the build inputs change
+	BuildNumber int64 `json:"buildNumber,omitempty"`
+
+	// Placement holds the spec placement with the omitted fields resolved from
+	// the vSphere inventory, resolved values are kept until set in the spec.
+	Placement *OSImagePlacement `json:"placement,omitempty"`
+
+	// ResourceBundleStrategy is the strategy used to resolve the resource bundle URL
+	ResourceBundleStrategy ResourceBundleAddressStrategy `json:"resourceBundleStrategy,omitempty"`
+
+	// ResourceBundleURL is the resource bundle URL used by the Packer VM
+	ResourceBundleURL string `json:"resourceBundleURL,omitempty"`
+
+	// LatestBuild is the OSImageBuild of the latest build attempt
+	LatestBuild string `json:"latestBuild,omitempty"`
+
+	// LatestSuccessfulBuild is the OSImageBuild of the latest published template
+	LatestSuccessfulBuild string `json:"latestSuccessfulBuild,omitempty"`
+
+	// BuiltTemplateMoid is the managed object ID of the template published by the
+	// latest successful build, templates created before its Job started are ignored.
+	BuiltTemplateMoid string `json:"builtTemplateMoid,omitempty"`
+
+	// Targets reports the build in each vCenter datacenter, the first target is
+	// built by this OSImage and the next ones by the additional targets OSImages.
+	Targets []OSImageTargetStatus `json:"targets,omitempty"`
+
 	// OSTemplates are the OVA templates in the vSphere
-	OSTemplates []OSImageTemplates `json:"templates"`
+	OSTemplates []OSImageTemplates `json:"templates,omitempty"`
+
+	// LastTemplateSync is the last time the templates were listed from vSphere
+	LastTemplateSync *metav1.Time `json:"lastTemplateSync,omitempty"`
 
 	// Conditions holds a list of internal conditions of the operator
-	Conditions []metav1.Condition `json:"conditions"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// OSImageTargetStatus is the build result in a vCenter datacenter
+type OSImageTargetStatus struct {
+	// Server is the vCenter address
+	Server string `json:"server,omitempty"`
+
+	// Datacenter is the datacenter path
+	Datacenter string `json:"datacenter,omitempty"`
+
+	// OSImage is the OSImage building the target
+	OSImage string `json:"osImage"`
+
+	// Phase is the build phase in the target
+	Phase OSImagePhase `json:"phase,omitempty"`
+
+	// TemplateMoid is the managed object ID of the published template
+	TemplateMoid string `json:"templateMoid,omitempty"`
 }
 
 type OSImageTemplates struct {
 	Name                 string `json:"name,omitempty"`
+	Moid                 string `json:"moid,omitempty"`
+	FolderMoid           string `json:"folderMoid,omitempty"`
 	BuildDate            string `json:"buildDate,omitempty"`
 	BuildTimestamp       string `json:"buildTimestamp,omitempty"`
 	CNIVersion           string `json:"cniVersion,omitempty"`
@@ -71,10 +298,17 @@ type OSImageTemplates struct {
 	ImageBuilderVersion  string `json:"imageBuilder,omitempty"`
 	KubernetesSemVer     string `json:"kubernetesSemver,omitempty"`
 	KubernetesSourceType string `json:"kubernetesSource,omitempty"`
+	WindowsVersion       string `json:"windowsVersion,omitempty"`
+	WindowsEdition       string `json:"windowsEdition,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Kubernetes",type=string,JSONPath=`.spec.kubernetesVersion`
+//+kubebuilder:printcolumn:name="Windows",type=string,JSONPath=`.spec.windowsVersion`
+//+kubebuilder:printcolumn:name="Build",type=integer,JSONPath=`.status.buildNumber`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // OSImage is the Schema for the osimages API
 type OSImage struct {
@@ -0,0 +1,118 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OSImageBuildSpec defines the inputs of a build attempt
+type OSImageBuildSpec struct {
+	// OSImageName is the OSImage that started the build
+	OSImageName string `json:"osImageName"`
+
+	// BuildNumber is the OSImage build number of this attempt
+	BuildNumber int64 `json:"buildNumber"`
+
+	// InputHash is the hash of the build inputs
+	InputHash string `json:"inputHash"`
+
+	// ImageBuilderImage is the image-builder image running the build
+	ImageBuilderImage string `json:"imageBuilderImage"`
+
+	// BundleImage is the windows-resource-bundle image serving the artifacts
+	BundleImage string `json:"bundleImage"`
+
+	// TemplateName is the vSphere template expected from the build
+	TemplateName string `json:"templateName"`
+}
+
+// OSImageBuildResult is the outcome of a build attempt
+// +kubebuilder:validation:Enum=Running;Succeeded;Failed;Superseded
+type OSImageBuildResult string
+
+const (
+	// BuildRunning has the build Job in progress
+	BuildRunning OSImageBuildResult = "Running"
+	// BuildSucceeded has the template published in vSphere
+	BuildSucceeded OSImageBuildResult = "Succeeded"
+	// BuildFailed has the build Job failed
+	BuildFailed OSImageBuildResult = "Failed"
+	// BuildSuperseded was replaced by a build with new inputs before finishing
+	BuildSuperseded OSImageBuildResult = "Superseded"
+)
+
+// OSImageBuildStatus defines the observed state of a build attempt
+type OSImageBuildStatus struct {
+	// Result is the outcome of the build
+	Result OSImageBuildResult `json:"result,omitempty"`
+
+	// StartTime is the time the build Job started
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the build finished
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// JobRef references the build Job
+	JobRef *corev1.ObjectReference `json:"jobRef,omitempty"`
+
+	// ImageBuilderDigest is the image ID of the image-builder container
+	ImageBuilderDigest string `json:"imageBuilderDigest,omitempty"`
+
+	// BundleDigest is the image ID of the windows-resource-bundle container
+	BundleDigest string `json:"bundleDigest,omitempty"`
+
+	// FailureReason holds the Job failure reason and message
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// TemplateName is the name of the template produced by the build
+	TemplateName string `json:"templateName,omitempty"`
+
+	// TemplateMoid is the vSphere managed object ID of the produced template
+	TemplateMoid string `json:"templateMoid,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="OSImage",type=string,JSONPath=`.spec.osImageName`
+//+kubebuilder:printcolumn:name="Build",type=integer,JSONPath=`.spec.buildNumber`
+//+kubebuilder:printcolumn:name="Result",type=string,JSONPath=`.status.result`
+//+kubebuilder:printcolumn:name="Template",type=string,JSONPath=`.status.templateName`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// OSImageBuild records a build attempt of an OSImage
+type OSImageBuild struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OSImageBuildSpec   `json:"spec,omitempty"`
+	Status OSImageBuildStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OSImageBuildList contains a list of OSImageBuild
+type OSImageBuildList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OSImageBuild `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OSImageBuild{}, &OSImageBuildList{})
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VSphereInventorySpec defines how the vCenter inventory is discovered
+type VSphereInventorySpec struct {
+	// RefreshInterval is the period between two inventory discoveries
+	// +kubebuilder:default="10m"
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshInterval,omitempty"`
+}
+
+// InventoryObject is a vSphere object usable in the OSImage spec
+type InventoryObject struct {
+	// Name is the object name
+	Name string `json:"name"`
+
+	// Moid is the vSphere managed object ID
+	Moid string `json:"moid"`
+
+	// Path is the full inventory path of the object
+	Path string `json:"path"`
+}
+
+// InventoryDatastore is a datastore with its capacity
+type InventoryDatastore struct {
+	InventoryObject `json:",inline"`
+
+	// Capacity is the maximum capacity of the datastore
+	Capacity resource.Quantity `json:"capacity"`
+
+	// FreeSpace is the available space of the datastore
+	FreeSpace resource.Quantity `json:"freeSpace"`
+}
+
+// InventoryDatacenter lists the objects found in a datacenter
+type InventoryDatacenter struct {
+	InventoryObject `json:",inline"`
+
+	Clusters      []InventoryObject    `json:"clusters,omitempty"`
+	ResourcePools []InventoryObject    `json:"resourcePools,omitempty"`
+	Folders       []InventoryObject    `json:"folders,omitempty"`
+	Networks      []InventoryObject    `json:"networks,omitempty"`
+	Datastores    []InventoryDatastore `json:"datastores,omitempty"`
+
+	// Error is the discovery failure of the datacenter, its objects are the ones of
+	// the last successful discovery
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// Condition types set on VSphereInventoryStatus
+const (
+	ConditionInventorySynced = "Synced"
+)
+
+// VSphereInventoryStatus defines the discovered vCenter inventory
+type VSphereInventoryStatus struct {
+	// Server is the vCenter address read from vsphere-cloud-config
+	Server string `json:"server,omitempty"`
+
+	// Datacenters holds the objects found in each datacenter
+	Datacenters []InventoryDatacenter `json:"datacenters,omitempty"`
+
+	// LastSyncTime is the time of the last discovery of the datacenters
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Conditions holds the discovery conditions
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.status.server`
+//+kubebuilder:printcolumn:name="Synced",type=string,JSONPath=`.status.conditions[?(@.type=="Synced")].status`
+//+kubebuilder:printcolumn:name="Last Sync",type=date,JSONPath=`.status.lastSyncTime`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// VSphereInventory lists the vCenter inventory seen with the management cluster credentials
+type VSphereInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VSphereInventorySpec   `json:"spec,omitempty"`
+	Status VSphereInventoryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VSphereInventoryList contains a list of VSphereInventory
+type VSphereInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VSphereInventory `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VSphereInventory{}, &VSphereInventoryList{})
+}
@@ -22,16 +22,93 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryDatacenter) DeepCopyInto(out *InventoryDatacenter) {
+	*out = *in
+	out.InventoryObject = in.InventoryObject
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]InventoryObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResourcePools != nil {
+		in, out := &in.ResourcePools, &out.ResourcePools
+		*out = make([]InventoryObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Folders != nil {
+		in, out := &in.Folders, &out.Folders
+		*out = make([]InventoryObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Networks != nil {
+		in, out := &in.Networks, &out.Networks
+		*out = make([]InventoryObject, len(*in))
+		copy(*out, *in)
+	}
+	if in.Datastores != nil {
+		in, out := &in.Datastores, &out.Datastores
+		*out = make([]InventoryDatastore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryDatacenter.
+func (in *InventoryDatacenter) DeepCopy() *InventoryDatacenter {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryDatacenter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryDatastore) DeepCopyInto(out *InventoryDatastore) {
+	*out = *in
+	out.InventoryObject = in.InventoryObject
+	out.Capacity = in.Capacity.DeepCopy()
+	out.FreeSpace = in.FreeSpace.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryDatastore.
+func (in *InventoryDatastore) DeepCopy() *InventoryDatastore {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryDatastore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InventoryObject) DeepCopyInto(out *InventoryObject) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InventoryObject.
+func (in *InventoryObject) DeepCopy() *InventoryObject {
+	if in == nil {
+		return nil
+	}
+	out := new(InventoryObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OSImage) DeepCopyInto(out *OSImage) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 }
 
@@ -53,6 +130,108 @@ func (in *OSImage) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImageBuild) DeepCopyInto(out *OSImageBuild) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageBuild.
+func (in *OSImageBuild) DeepCopy() *OSImageBuild {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImageBuild)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OSImageBuild) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImageBuildList) DeepCopyInto(out *OSImageBuildList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]OSImageBuild, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageBuildList.
+func (in *OSImageBuildList) DeepCopy() *OSImageBuildList {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImageBuildList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *OSImageBuildList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImageBuildSpec) DeepCopyInto(out *OSImageBuildSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageBuildSpec.
+func (in *OSImageBuildSpec) DeepCopy() *OSImageBuildSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImageBuildSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImageBuildStatus) DeepCopyInto(out *OSImageBuildStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.JobRef != nil {
+		in, out := &in.JobRef, &out.JobRef
+		*out = new(v1.ObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageBuildStatus.
+func (in *OSImageBuildStatus) DeepCopy() *OSImageBuildStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImageBuildStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OSImageList) DeepCopyInto(out *OSImageList) {
 	*out = *in
@@ -85,9 +264,63 @@ func (in *OSImageList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImagePlacement) DeepCopyInto(out *OSImagePlacement) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImagePlacement.
+func (in *OSImagePlacement) DeepCopy() *OSImagePlacement {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImagePlacement)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OSImageSpec) DeepCopyInto(out *OSImageSpec) {
 	*out = *in
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.PackerVariablesRef != nil {
+		in, out := &in.PackerVariablesRef, &out.PackerVariablesRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.PackerVariables != nil {
+		in, out := &in.PackerVariables, &out.PackerVariables
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ResourceBundleAddress != nil {
+		in, out := &in.ResourceBundleAddress, &out.ResourceBundleAddress
+		*out = new(ResourceBundleAddress)
+		**out = **in
+	}
+	if in.AdditionalTargets != nil {
+		in, out := &in.AdditionalTargets, &out.AdditionalTargets
+		*out = make([]VSphereTarget, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BuildHistoryLimit != nil {
+		in, out := &in.BuildHistoryLimit, &out.BuildHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TemplateResyncInterval != nil {
+		in, out := &in.TemplateResyncInterval, &out.TemplateResyncInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageSpec.
@@ -103,14 +336,28 @@ func (in *OSImageSpec) DeepCopy() *OSImageSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OSImageStatus) DeepCopyInto(out *OSImageStatus) {
 	*out = *in
+	if in.Placement != nil {
+		in, out := &in.Placement, &out.Placement
+		*out = new(OSImagePlacement)
+		**out = **in
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]OSImageTargetStatus, len(*in))
+		copy(*out, *in)
+	}
 	if in.OSTemplates != nil {
 		in, out := &in.OSTemplates, &out.OSTemplates
 		*out = make([]OSImageTemplates, len(*in))
 		copy(*out, *in)
 	}
+	if in.LastTemplateSync != nil {
+		in, out := &in.LastTemplateSync, &out.LastTemplateSync
+		*out = (*in).DeepCopy()
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]v1.Condition, len(*in))
+		*out = make([]metav1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -127,6 +374,21 @@ func (in *OSImageStatus) DeepCopy() *OSImageStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSImageTargetStatus) DeepCopyInto(out *OSImageTargetStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSImageTargetStatus.
+func (in *OSImageTargetStatus) DeepCopy() *OSImageTargetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OSImageTargetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *OSImageTemplates) DeepCopyInto(out *OSImageTemplates) {
 	*out = *in
@@ -141,3 +403,150 @@ func (in *OSImageTemplates) DeepCopy() *OSImageTemplates {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceBundleAddress) DeepCopyInto(out *ResourceBundleAddress) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBundleAddress.
+func (in *ResourceBundleAddress) DeepCopy() *ResourceBundleAddress {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceBundleAddress)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereInventory) DeepCopyInto(out *VSphereInventory) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereInventory.
+func (in *VSphereInventory) DeepCopy() *VSphereInventory {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereInventory)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereInventory) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereInventoryList) DeepCopyInto(out *VSphereInventoryList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VSphereInventory, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereInventoryList.
+func (in *VSphereInventoryList) DeepCopy() *VSphereInventoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereInventoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VSphereInventoryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereInventorySpec) DeepCopyInto(out *VSphereInventorySpec) {
+	*out = *in
+	if in.RefreshInterval != nil {
+		in, out := &in.RefreshInterval, &out.RefreshInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereInventorySpec.
+func (in *VSphereInventorySpec) DeepCopy() *VSphereInventorySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereInventorySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereInventoryStatus) DeepCopyInto(out *VSphereInventoryStatus) {
+	*out = *in
+	if in.Datacenters != nil {
+		in, out := &in.Datacenters, &out.Datacenters
+		*out = make([]InventoryDatacenter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereInventoryStatus.
+func (in *VSphereInventoryStatus) DeepCopy() *VSphereInventoryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereInventoryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VSphereTarget) DeepCopyInto(out *VSphereTarget) {
+	*out = *in
+	if in.CredentialsRef != nil {
+		in, out := &in.CredentialsRef, &out.CredentialsRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VSphereTarget.
+func (in *VSphereTarget) DeepCopy() *VSphereTarget {
+	if in == nil {
+		return nil
+	}
+	out := new(VSphereTarget)
+	in.DeepCopyInto(out)
+	return out
+}
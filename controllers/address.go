@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// bundleAddressStrategy returns the resource bundle address strategy of the spec
+func bundleAddressStrategy(o *v1alpha1.OSImage) v1alpha1.ResourceBundleAddressStrategy {
+	if o.Spec.ResourceBundleAddress == nil || o.Spec.ResourceBundleAddress.Strategy == "" {
+		return v1alpha1.AddressNodePort
+	}
+	return o.Spec.ResourceBundleAddress.Strategy
+}
+
+// bundleServiceType returns the Service type exposing the resource bundle for the strategy
+func bundleServiceType(o *v1alpha1.OSImage) v1.ServiceType {
+	switch bundleAddressStrategy(o) {
+	case v1alpha1.AddressLoadBalancer:
+		return v1.ServiceTypeLoadBalancer
+	case v1alpha1.AddressOverride:
+		return v1.ServiceTypeClusterIP
+	}
+	return v1.ServiceTypeNodePort
+}
+
+// resolveBundleURL returns the resource bundle base URL reachable from the Packer VM,
+// an empty URL means the address is not assigned yet. The URL in the status is kept
+// while it is still one of the strategy addresses, the build inputs include it.
+func (r *OSImageReconciler) resolveBundleURL(ctx context.Context, o *v1alpha1.OSImage, svc *v1.Service) (string, error) {
+	urls, err := r.bundleURLs(ctx, o, svc)
+	if err != nil || len(urls) == 0 {
+		return "", err
+	}
+	for _, url := range urls {
+		if url == o.Status.ResourceBundleURL {
+			return url, nil
+		}
+	}
+	return urls[0], nil
+}
+
+// bundleURLs returns the resource bundle URLs of the address strategy, by preference
+func (r *OSImageReconciler) bundleURLs(ctx context.Context, o *v1alpha1.OSImage, svc *v1.Service) ([]string, error) {
+	switch strategy := bundleAddressStrategy(o); strategy {
+	case v1alpha1.AddressOverride:
+		if o.Spec.ResourceBundleAddress.URL == "" {
+			return nil, fmt.Errorf("resource bundle url is required by the %s strategy", strategy)
+		}
+		return []string{o.Spec.ResourceBundleAddress.URL}, nil
+
+	case v1alpha1.AddressLoadBalancer:
+		var urls []string
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			host := ingress.IP
+			if host == "" {
+				host = ingress.Hostname
+			}
+			if host != "" {
+				urls = append(urls, fmt.Sprintf("http://%s:%d", host, svc.Spec.Ports[0].Port))
+			}
+		}
+		return urls, nil
+
+	case v1alpha1.AddressNodePort:
+		nodePort := svc.Spec.Ports[0].NodePort
+		if nodePort == 0 {
+			return nil, nil
+		}
+		addresses, err := r.getNodeAddresses(ctx)
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, 0, len(addresses))
+		for _, address := range addresses {
+			urls = append(urls, fmt.Sprintf("http://%s:%d", address, nodePort))
+		}
+		return urls, nil
+
+	default:
+		return nil, fmt.Errorf("resource bundle address strategy %s is not supported", strategy)
+	}
+}
+
+// getNodeAddresses returns the InternalIP of the ready nodes sorted by name
+func (r *OSImageReconciler) getNodeAddresses(ctx context.Context) ([]string, error) {
+	nodes := &v1.NodeList{}
+	if err := r.apiReader().List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+	var addresses []string
+	for i := range nodes.Items {
+		if !isNodeReady(&nodes.Items[i]) {
+			continue
+		}
+		for _, address := range nodes.Items[i].Status.Addresses {
+			if address.Type == v1.NodeInternalIP {
+				addresses = append(addresses, address.Address)
+				break
+			}
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no ready node with an InternalIP found")
+	}
+	return addresses, nil
+}
+
+// isNodeReady returns true when the node Ready condition is true
+func isNodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newNode returns a node with the InternalIP and the Ready condition
+func newNode(name, address string, ready v1.ConditionStatus) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Addresses:  []v1.NodeAddress{{Type: v1.NodeHostName, Address: name}, {Type: v1.NodeInternalIP, Address: address}},
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: ready}},
+		},
+	}
+}
+
+var _ = Describe("Resource bundle address", func() {
+	var (
+		ctx        = context.Background()
+		c          client.Client
+		reconciler *OSImageReconciler
+		o          *imagebuilderv1alpha1.OSImage
+		svc        *v1.Service
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		c = clientfake.NewClientBuilder().WithScheme(scheme).Build()
+		reconciler = &OSImageReconciler{Client: c, APIReader: c, Scheme: scheme}
+
+		o = newOSImage("windows")
+		svc = &v1.Service{Spec: v1.ServiceSpec{Ports: []v1.ServicePort{{Port: 8080, NodePort: 30008}}}}
+	})
+
+	setStrategy := func(strategy imagebuilderv1alpha1.ResourceBundleAddressStrategy, url string) {
+		o.Spec.ResourceBundleAddress = &imagebuilderv1alpha1.ResourceBundleAddress{Strategy: strategy, URL: url}
+	}
+
+	Describe("with the Override strategy", func() {
+		It("should use the spec URL", func() {
+			setStrategy(imagebuilderv1alpha1.AddressOverride, "http://bundle.example.com")
+			o.Status.ResourceBundleURL = "http://10.0.0.10:30008"
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(Equal("http://bundle.example.com"))
+			Expect(bundleServiceType(o)).To(Equal(v1.ServiceTypeClusterIP))
+		})
+		It("should require the URL", func() {
+			setStrategy(imagebuilderv1alpha1.AddressOverride, "")
+			_, err := reconciler.resolveBundleURL(ctx, o, svc)
+			Expect(err).To(MatchError("resource bundle url is required by the Override strategy"))
+		})
+	})
+
+	Describe("with the LoadBalancer strategy", func() {
+		BeforeEach(func() {
+			setStrategy(imagebuilderv1alpha1.AddressLoadBalancer, "")
+		})
+
+		It("should wait for the ingress", func() {
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(BeEmpty())
+			Expect(bundleServiceType(o)).To(Equal(v1.ServiceTypeLoadBalancer))
+		})
+		It("should use the ingress IP or hostname and the Service port", func() {
+			svc.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{{Hostname: "bundle.example.com"}, {IP: "10.0.0.60"}}
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(Equal("http://bundle.example.com:8080"))
+
+			o.Status.ResourceBundleURL = "http://10.0.0.60:8080"
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(Equal("http://10.0.0.60:8080"))
+		})
+	})
+
+	Describe("with the NodePort strategy", func() {
+		It("should wait for the node port", func() {
+			svc.Spec.Ports[0].NodePort = 0
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(BeEmpty())
+			Expect(bundleServiceType(o)).To(Equal(v1.ServiceTypeNodePort))
+		})
+		It("should fail without ready node", func() {
+			Expect(c.Create(ctx, newNode("node-a", "10.0.0.10", v1.ConditionFalse))).To(Succeed())
+			_, err := reconciler.resolveBundleURL(ctx, o, svc)
+			Expect(err).To(MatchError("no ready node with an InternalIP found"))
+		})
+		It("should keep the node address while the node is ready", func() {
+			Expect(c.Create(ctx, newNode("node-b", "10.0.0.11", v1.ConditionTrue))).To(Succeed())
+			Expect(c.Create(ctx, newNode("node-c", "10.0.0.12", v1.ConditionTrue))).To(Succeed())
+			Expect(c.Create(ctx, newNode("node-d", "10.0.0.13", v1.ConditionFalse))).To(Succeed())
+			url, err := reconciler.resolveBundleURL(ctx, o, svc)
+			Expect(err).To(BeNil())
+			Expect(url).To(Equal("http://10.0.0.11:30008"))
+			o.Status.ResourceBundleURL = url
+
+			// A node sorted first joins the cluster.
+			Expect(c.Create(ctx, newNode("node-a", "10.0.0.10", v1.ConditionTrue))).To(Succeed())
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(Equal("http://10.0.0.11:30008"))
+
+			// The node goes NotReady.
+			Expect(c.Update(ctx, newNode("node-b", "10.0.0.11", v1.ConditionFalse))).To(Succeed())
+			Expect(reconciler.resolveBundleURL(ctx, o, svc)).To(Equal("http://10.0.0.10:30008"))
+		})
+	})
+})
@@ -22,7 +22,7 @@ var (
 const (
 	BUILDER_DEPLOYMENT = "manifests/builder-deployment.yaml"
 	BUILDER_SERVICE    = "manifests/builder-svc.yaml"
-	IB_CONFIG          = "manifests/ib-configmap.yaml"
+	IB_SECRET          = "manifests/ib-secret.yaml"
 	IB_JOB             = "manifests/ib-job.yaml"
 )
 
@@ -40,7 +40,7 @@ func init() {
 
 // ObjectTypes defines the generic types available
 type ObjectTypes interface {
-	*appsv1.Deployment | *v1.Service | *v1.Namespace | *v1.ConfigMap | *batchv1.Job
+	*appsv1.Deployment | *v1.Service | *v1.Namespace | *v1.ConfigMap | *v1.Secret | *batchv1.Job
 }
 
 // YAMLAccessor implement the definition of YAML accessor
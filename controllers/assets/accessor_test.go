@@ -38,5 +38,15 @@ var _ = Describe("Object decoding", func() {
 				Expect(len(service.Spec.Ports)).To(Equal(1))
 			})
 		})
+		Context("Of type secret", func() {
+			It("it should decode the object correctly", func() {
+				accessor := assets.YAMLAccessor[*v1.Secret]{}
+				secret, err := accessor.GetDecodedObject(assets.IB_SECRET, v1.SchemeGroupVersion)
+
+				Expect(err).To(BeNil())
+				Expect(secret.Name).To(Equal("ib-windows"))
+				Expect(secret.Type).To(Equal(v1.SecretTypeOpaque))
+			})
+		})
 	})
 })
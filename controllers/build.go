@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// AnnotationBuildHash holds the hash of the build inputs used by the Job
+	AnnotationBuildHash = "imagebuilder.tanzu.opssec.in/build-hash"
+	// AnnotationBuildNumber holds the sequential build number of the Job
+	AnnotationBuildNumber = "imagebuilder.tanzu.opssec.in/build-number"
+)
+
+// credentialVariables are not build inputs, rotating them must not trigger a rebuild.
+var credentialVariables = []string{"username", "password"}
+
+// buildHash returns the hash of the effective build inputs, the packer variables
+// without credentials plus the Job container images and args. The variables are
+// rendered without the resource bundle URL, the bundle serves the same files from
+// any node or ingress address.
+func buildHash(config string, job *batchv1.Job) (string, error) {
+	variables := map[string]string{}
+	if err := json.Unmarshal([]byte(config), &variables); err != nil {
+		return "", err
+	}
+	for _, key := range credentialVariables {
+		delete(variables, key)
+	}
+
+	hasher := sha256.New()
+	if err := json.NewEncoder(hasher).Encode(variables); err != nil {
+		return "", err
+	}
+	for _, c := range job.Spec.Template.Spec.Containers {
+		fmt.Fprintf(hasher, "%s%v", c.Image, c.Args)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil))[:16], nil
+}
+
+// getBuildNumber returns the build number recorded on the Job
+func getBuildNumber(job *batchv1.Job) int64 {
+	number, err := strconv.ParseInt(job.Annotations[AnnotationBuildNumber], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// setBuildAnnotations records the build hash and number on the object annotations
+func setBuildAnnotations(annotations map[string]string, hash string, number int64) map[string]string {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationBuildHash] = hash
+	annotations[AnnotationBuildNumber] = strconv.FormatInt(number, 10)
+	return annotations
+}
+
+const (
+	// AnnotationOSImage holds the namespace/name of the OSImage owning a build resource
+	AnnotationOSImage = "imagebuilder.tanzu.opssec.in/osimage"
+	// LabelOSImageUID selects the build resources of an OSImage
+	LabelOSImageUID = "imagebuilder.tanzu.opssec.in/osimage-uid"
+
+	// BuildFinalizer cleans the build resources living outside the OSImage namespace
+	BuildFinalizer = "imagebuilder.tanzu.opssec.in/build-resources"
+
+	// Suffixes of the build resources names
+	suffixResourceKit = "windows-resource-kit"
+	suffixResource    = "windows-resource"
+	suffixSecret      = "ib-windows"
+	suffixJob         = "ib-job"
+)
+
+// buildNamespace returns the namespace hosting the OSImage build resources
+func (r *OSImageReconciler) buildNamespace(o *v1alpha1.OSImage) string {
+	if r.BuildNamespace != "" {
+		return r.BuildNamespace
+	}
+	return o.Namespace
+}
+
+// buildObjectName returns the name of a build resource, long OSImage names are
+// truncated and made unique with the UID so the result is a valid DNS label.
+func buildObjectName(o *v1alpha1.OSImage, suffix string) string {
+	name := fmt.Sprintf("%s-%s", o.Name, suffix)
+	if len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	uid := strings.ReplaceAll(string(o.UID), "-", "")[:8]
+	prefix := o.Name[:validation.DNS1123LabelMaxLength-len(suffix)-len(uid)-2]
+	return fmt.Sprintf("%s-%s-%s", strings.TrimRight(prefix, "-."), uid, suffix)
+}
+
+// setBuildObjectMeta names a build resource after the OSImage and links it back,
+// the controller reference is only valid in the OSImage namespace.
+func (r *OSImageReconciler) setBuildObjectMeta(o *v1alpha1.OSImage, object client.Object, suffix string) error {
+	object.SetName(buildObjectName(o, suffix))
+	object.SetNamespace(r.buildNamespace(o))
+
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelOSImageUID] = string(o.UID)
+	object.SetLabels(labels)
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationOSImage] = client.ObjectKeyFromObject(o).String()
+	object.SetAnnotations(annotations)
+
+	if object.GetNamespace() != o.Namespace {
+		return nil
+	}
+	return ctrl.SetControllerReference(o, object, r.Scheme)
+}
+
+// deleteBuildResources removes the OSImage build resources, required when they
+// live in another namespace and are not garbage collected.
+func (r *OSImageReconciler) deleteBuildResources(ctx context.Context, o *v1alpha1.OSImage) error {
+	objects := map[string]client.Object{
+		suffixResourceKit: &appsv1.Deployment{},
+		suffixResource:    &v1.Service{},
+		suffixSecret:      &v1.Secret{},
+		suffixJob:         &batchv1.Job{},
+	}
+	for suffix, object := range objects {
+		object.SetName(buildObjectName(o, suffix))
+		object.SetNamespace(r.buildNamespace(o))
+		if err := r.Delete(ctx, object, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestsForBuildObject maps a build resource event to the OSImage owning it
+func requestsForBuildObject(object client.Object) []reconcile.Request {
+	namespace, name, err := cache.SplitMetaNamespaceKey(object.GetAnnotations()[AnnotationOSImage])
+	if err != nil || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
+}
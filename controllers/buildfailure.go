@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// setBuildFailedCondition sets the BuildFailed condition from the failed Job. The Packer
+// output has the build credentials, the message only names the pod to read the logs of.
+// The pods are listed once per spec generation.
+func (r *OSImageReconciler) setBuildFailedCondition(ctx context.Context, o *v1alpha1.OSImage, job *batchv1.Job) {
+	condition := meta.FindStatusCondition(o.Status.Conditions, v1alpha1.ConditionBuildFailed)
+	if condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == o.Generation {
+		return
+	}
+
+	reason, message := ReasonJobFailed, fmt.Sprintf("job %s failed", job.Name)
+	for _, c := range job.Status.Conditions {
+		if c.Type == batchv1.JobFailed && c.Status == v1.ConditionTrue {
+			if c.Reason != "" {
+				reason = c.Reason
+			}
+			if c.Message != "" {
+				message = fmt.Sprintf("%s: %s", message, c.Message)
+			}
+		}
+	}
+
+	pod, err := r.newestBuildPod(ctx, job)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "unable to list the build pods", "job", job.Name)
+	}
+	if pod != nil {
+		message = fmt.Sprintf("%s, run kubectl logs -n %s %s for the build logs", message, pod.Namespace, pod.Name)
+	}
+	setCondition(o, v1alpha1.ConditionBuildFailed, metav1.ConditionTrue, reason, message)
+}
+
+// newestBuildPod returns the newest Job pod, nil when the pods are gone.
+func (r *OSImageReconciler) newestBuildPod(ctx context.Context, job *batchv1.Job) (*v1.Pod, error) {
+	pods := &v1.PodList{}
+	if err := r.apiReader().List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, err
+	}
+	var newest *v1.Pod
+	for i := range pods.Items {
+		if newest == nil || newest.CreationTimestamp.Before(&pods.Items[i].CreationTimestamp) {
+			newest = &pods.Items[i]
+		}
+	}
+	return newest, nil
+}
@@ -1,8 +1,25 @@
 package controllers
 
 import (
+	"context"
+	"strings"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/controllers/assets"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/fake"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"github.com/knabben/tkw/pkg/windows"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 const configMapData = `
@@ -13,27 +30,198 @@ const configMapData = `
 	[VirtualCenter "10.0.0.1"]
 		datacenters = "/dc0"
 		insecure-flag = "1"
+	[VirtualCenter "10.0.0.3"]
+		datacenters = "/dc1,/dc2"
 `
 
-var _ = Describe("ConfigMap parsing", func() {
-	Describe("Having a defined TOML file", func() {
-		Context("with separated categories", func() {
-			It("should find the VC", func() {
-				value := extractRValue(`\[VirtualCenter "(.*)"\]`, configMapData)
-				Expect(value).To(Equal("10.0.0.1"))
-			})
-			It("should find the secret namespace", func() {
-				value := extractRValue(`secret-namespace = "(.*)"`, configMapData)
-				Expect(value).To(Equal("kube-system"))
-			})
-			It("should find the secret name", func() {
-				value := extractRValue(`secret-name = "(.*)"`, configMapData)
-				Expect(value).To(Equal("cloud-provider-vsphere-credentials"))
-			})
-			It("not find value must be empty", func() {
-				value := extractRValue(`not-existing = "(.*)"`, configMapData)
-				Expect(value).To(Equal(""))
-			})
+var _ = Describe("Build hash", func() {
+	job := &batchv1.Job{Spec: batchv1.JobSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+		Containers: []v1.Container{{Image: "image-builder", Args: []string{"build-node-ova-vsphere-windows-2019"}}},
+	}}}}
+
+	Context("with the same build inputs", func() {
+		It("should ignore the credentials", func() {
+			first, err := buildHash(`{"folder": "folder0", "password": "old"}`, job)
+			Expect(err).To(BeNil())
+			second, err := buildHash(`{"folder": "folder0", "password": "new"}`, job)
+			Expect(err).To(BeNil())
+			Expect(first).To(Equal(second))
+		})
+	})
+	Context("with another resource bundle address", func() {
+		It("should ignore the bundle URL", func() {
+			o := newOSImage("windows")
+			release, err := windows.GetKubernetesRelease(o.Spec.KubernetesVersion)
+			Expect(err).To(BeNil())
+			target, err := windows.GetOSTarget(o.Spec.WindowsVersion, o.Spec.WindowsEdition)
+			Expect(err).To(BeNil())
+			hash := func(bundleURL string, overrides map[string]string) string {
+				rendered, hashConfig, err := renderBuildConfig(&config.Mapper{}, bundleURL, release, target, o, overrides)
+				Expect(err).To(BeNil())
+				Expect(rendered).To(ContainSubstring(strings.TrimSuffix(bundleURL, "/") + "/files/"))
+				h, err := buildHash(hashConfig, job)
+				Expect(err).To(BeNil())
+				return h
+			}
+
+			first := hash("http://10.0.0.10:30008", nil)
+			Expect(hash("http://10.0.0.11:30008/", nil)).To(Equal(first))
+
+			// The user variables holding the bundle address are still build inputs.
+			overrides := map[string]string{"custom_url": "http://10.0.0.10:30008/files/custom.zip"}
+			Expect(hash("http://10.0.0.10:30008", overrides)).NotTo(Equal(first))
+		})
+	})
+	Context("with different build inputs", func() {
+		It("should change the hash", func() {
+			first, err := buildHash(`{"folder": "folder0"}`, job)
+			Expect(err).To(BeNil())
+			second, err := buildHash(`{"folder": "folder1"}`, job)
+			Expect(err).To(BeNil())
+			Expect(first).NotTo(Equal(second))
 		})
 	})
 })
+
+var _ = Describe("Packer trust settings", func() {
+	var cmap *config.Mapper
+
+	BeforeEach(func() {
+		cmap = &config.Mapper{}
+		cmap.Set(vsphere.VsphereServer, "10.0.0.1")
+	})
+
+	It("should trust the CA bundle", func() {
+		cmap.Set(vsphere.VsphereCABundle, "-----BEGIN CERTIFICATE-----")
+		cmap.Set(vsphere.VsphereThumbprint, "AA:BB")
+		caBundle, err := packerCABundle(context.Background(), cmap)
+		Expect(err).To(BeNil())
+		Expect(string(caBundle)).To(Equal("-----BEGIN CERTIFICATE-----"))
+	})
+	It("should not trust anything on insecure connections", func() {
+		cmap.Set(vsphere.VsphereCABundle, "-----BEGIN CERTIFICATE-----")
+		cmap.Set(vsphere.VsphereInsecure, "true")
+		Expect(packerCABundle(context.Background(), cmap)).To(BeEmpty())
+	})
+	It("should mount the CA bundle in the build Job", func() {
+		job := assets.YAMLAccessor[*batchv1.Job]{}
+		jobObject, err := job.GetDecodedObject(assets.IB_JOB, batchv1.SchemeGroupVersion)
+		Expect(err).To(BeNil())
+
+		setPackerCABundle(jobObject)
+		podSpec := jobObject.Spec.Template.Spec
+		Expect(podSpec.Volumes[0].Secret.Items).To(ContainElement(v1.KeyToPath{Key: "ca.crt", Path: "ca.crt"}))
+		Expect(podSpec.Containers[0].Env).To(ContainElement(v1.EnvVar{
+			Name: "SSL_CERT_FILE", Value: "/home/imagebuilder/packer/ova/config/ca.crt",
+		}))
+	})
+})
+
+var _ = Describe("Build resource names", func() {
+	It("should prefix the resources with the OSImage name", func() {
+		o := &imagebuilderv1alpha1.OSImage{ObjectMeta: metav1.ObjectMeta{Name: "windows-image", UID: "1b4e28ba-2fa1-11d2-883f-0016d3cca427"}}
+		Expect(buildObjectName(o, suffixJob)).To(Equal("windows-image-ib-job"))
+	})
+	It("should keep long names unique and under the DNS label limit", func() {
+		o := &imagebuilderv1alpha1.OSImage{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 70), UID: "1b4e28ba-2fa1-11d2-883f-0016d3cca427"}}
+		name := buildObjectName(o, suffixResourceKit)
+		Expect(len(name)).To(BeNumerically("<=", 63))
+		Expect(name).To(HaveSuffix("-1b4e28ba-windows-resource-kit"))
+	})
+})
+
+var _ = Describe("Placement resolution", func() {
+	var (
+		r    *OSImageReconciler
+		cmap *config.Mapper
+		o    *imagebuilderv1alpha1.OSImage
+	)
+
+	BeforeEach(func() {
+		r = &OSImageReconciler{}
+		cmap = &config.Mapper{}
+		cmap.Set(vsphere.VsphereDataCenter, "dc0")
+		o = &imagebuilderv1alpha1.OSImage{
+			Spec: imagebuilderv1alpha1.OSImageSpec{VSphereNetwork: "/dc0/network/VM Network"},
+			Status: imagebuilderv1alpha1.OSImageStatus{Placement: &imagebuilderv1alpha1.OSImagePlacement{
+				Datacenter:   "/dc0",
+				Folder:       "/dc0/vm",
+				Datastore:    "/dc0/datastore/ds0",
+				Network:      "/dc0/network/old",
+				ResourcePool: "/dc0/host/cluster0/Resources",
+				Cluster:      "/dc0/host/cluster0",
+			}},
+		}
+	})
+
+	It("should keep the resolved values and prefer the spec", func() {
+		Expect(r.resolvePlacement(context.Background(), cmap, o)).To(Succeed())
+		Expect(o.Status.Placement.Network).To(Equal("/dc0/network/VM Network"))
+		Expect(o.Status.Placement.Datastore).To(Equal("/dc0/datastore/ds0"))
+		Expect(cmap.Get(vsphere.VsphereDataCenter)).To(Equal("/dc0"))
+	})
+	It("should look up the management nodes with one virtual machine listing", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		r.APIReader = clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newNode("node-a", "10.0.0.10", v1.ConditionTrue),
+			newNode("node-b", "10.0.0.11", v1.ConditionTrue),
+			newNode("node-c", "10.0.0.12", v1.ConditionTrue),
+		).Build()
+		vc := fake.NewClient()
+		dc := vc.AddDatacenter("datacenter-2", "/dc0")
+		nodePlacement := &vsphere.VirtualMachinePlacement{Cluster: &models.VSphereManagementObject{Path: "/dc0/host/cluster1"}}
+		dc.Placements["node-b"] = nodePlacement
+		dc.Placements["workload-node"] = &vsphere.VirtualMachinePlacement{}
+
+		placement, err := r.managementNodePlacement(context.Background(), vc, "datacenter-2")
+		Expect(err).To(BeNil())
+		Expect(placement).To(BeIdenticalTo(nodePlacement))
+		Expect(vc.Calls()).To(Equal([]string{"GetVirtualMachinePlacement"}))
+	})
+	It("should root datacenter names", func() {
+		Expect(datacenterPath("dc0")).To(Equal("/dc0"))
+		Expect(datacenterPath("/dc0")).To(Equal("/dc0"))
+		Expect(datacenterPath("")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Packer variables ConfigMap", func() {
+	It("should map the ConfigMap to the OSImages referencing it", func() {
+		scheme := runtime.NewScheme()
+		Expect(imagebuilderv1alpha1.AddToScheme(scheme)).To(Succeed())
+		referencing, other := newOSImage("windows"), newOSImage("other")
+		referencing.Spec.PackerVariablesRef = &v1.LocalObjectReference{Name: "windows-packer-variables"}
+		r := &OSImageReconciler{Client: clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(referencing, other).Build()}
+
+		cm := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "windows-packer-variables", Namespace: referencing.Namespace}}
+		requests := r.requestsForPackerVariables(cm)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("windows"))
+
+		cm.Namespace = "other"
+		Expect(r.requestsForPackerVariables(cm)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Legacy resources cleanup", func() {
+	It("should delete the windows.json configmap", func() {
+		ctx := context.Background()
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: legacyConfigMap.Namespace}}
+		if err := k8sClient.Create(ctx, ns); !apierrors.IsAlreadyExists(err) {
+			Expect(err).To(BeNil())
+		}
+		cm := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: legacyConfigMap.Namespace, Name: legacyConfigMap.Name},
+			Data:       map[string]string{"windows.json": `{"password": "secret"}`},
+		}
+		Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+
+		cleanup := &LegacyCleanup{Client: k8sClient}
+		Expect(cleanup.Start(ctx)).To(Succeed())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, legacyConfigMap, &v1.ConfigMap{}))).To(BeTrue())
+
+		// Nothing is left to delete on the next start.
+		Expect(cleanup.Start(ctx)).To(Succeed())
+	})
+})
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Keys of a vSphere credentials Secret
+const (
+	CredentialsServerKey     = "server"
+	CredentialsUsernameKey   = "username"
+	CredentialsPasswordKey   = "password"
+	CredentialsThumbprintKey = "thumbprint"
+	CredentialsDatacenterKey = "datacenter"
+	CredentialsCABundleKey   = "ca.crt"
+	CredentialsInsecureKey   = "insecure"
+)
+
+// CredentialsReaderRole is the ClusterRole of config/rbac reading the credentials Secrets,
+// it is only bound in the controller namespace.
+const CredentialsReaderRole = "tkw-credentials-reader"
+
+// Credentials loads the vSphere credentials of the controllers. Secrets are read
+// with an uncached reader, so the controller does not list and watch every Secret.
+type Credentials struct {
+	// Reader reads the vsphere-cloud-config ConfigMap
+	Reader client.Reader
+
+	// SecretReader reads the credentials Secrets
+	SecretReader client.Reader
+
+	// DefaultSecret is used by the OSImages without credentialsRef, the
+	// vsphere-cloud-config credentials are used when it is nil.
+	DefaultSecret *types.NamespacedName
+}
+
+// credentialsSecret returns the credentials Secret of the OSImage, or the default one
+func (c *Credentials) credentialsSecret(o *v1alpha1.OSImage) *types.NamespacedName {
+	if o != nil && o.Spec.CredentialsRef != nil {
+		return &types.NamespacedName{Namespace: o.Namespace, Name: o.Spec.CredentialsRef.Name}
+	}
+	return c.DefaultSecret
+}
+
+// Load sets the OSImage credentials in the mapper and returns their source and the
+// warning of the ignored settings, the default credentials are loaded when the OSImage
+// is nil. The OSImage vsphereServer selects the vsphere-cloud-config vCenter and must
+// match the credentials Secret.
+func (c *Credentials) Load(ctx context.Context, o *v1alpha1.OSImage, cmap *config.Mapper) (string, string, error) {
+	secrets := c.SecretReader
+	if secrets == nil {
+		secrets = c.Reader
+	}
+
+	var server string
+	if o != nil {
+		server = o.Spec.VSphereServer
+	}
+
+	key := c.credentialsSecret(o)
+	if key == nil {
+		source := fmt.Sprintf("configmap %s/vsphere-cloud-config", TKG_NAMESPACE)
+		warning, err := getCloudConfigCredentials(ctx, c.Reader, secrets, server, cmap)
+		return source, warning, err
+	}
+	source := fmt.Sprintf("secret %s", key)
+	if err := getSecretCredentials(ctx, secrets, *key, cmap); err != nil {
+		return source, "", err
+	}
+	if server != "" && cmap.Get(vsphere.VsphereServer) != server {
+		return source, "", fmt.Errorf("secret %s is for vCenter %s, not %s", key, cmap.Get(vsphere.VsphereServer), server)
+	}
+	return source, "", nil
+}
+
+// getSecretCredentials sets the credentials of the Secret in the mapper
+func getSecretCredentials(ctx context.Context, secrets client.Reader, key types.NamespacedName, cmap *config.Mapper) error {
+	secret := &v1.Secret{}
+	if err := secrets.Get(ctx, key, secret); errors.IsForbidden(err) {
+		return fmt.Errorf("%w, bind the %s ClusterRole in namespace %s", err, CredentialsReaderRole, key.Namespace)
+	} else if err != nil {
+		return err
+	}
+	for _, required := range []string{CredentialsServerKey, CredentialsUsernameKey, CredentialsPasswordKey} {
+		if len(secret.Data[required]) == 0 {
+			return fmt.Errorf("secret %s has no %s key", key, required)
+		}
+	}
+	cmap.Set(vsphere.VsphereServer, string(secret.Data[CredentialsServerKey]))
+	cmap.Set(vsphere.VsphereUsername, string(secret.Data[CredentialsUsernameKey]))
+	cmap.Set(vsphere.VspherePassword, string(secret.Data[CredentialsPasswordKey]))
+	cmap.Set(vsphere.VsphereThumbprint, string(secret.Data[CredentialsThumbprintKey]))
+	cmap.Set(vsphere.VsphereCABundle, string(secret.Data[CredentialsCABundleKey]))
+	cmap.Set(vsphere.VsphereDataCenter, string(secret.Data[CredentialsDatacenterKey]))
+
+	insecure := false
+	if value := secret.Data[CredentialsInsecureKey]; len(value) > 0 {
+		var err error
+		if insecure, err = strconv.ParseBool(string(value)); err != nil {
+			return fmt.Errorf("secret %s has an invalid %s key: %v", key, CredentialsInsecureKey, err)
+		}
+	}
+	cmap.Set(vsphere.VsphereInsecure, strconv.FormatBool(insecure))
+	return nil
+}
+
+// credentialsOrDefault returns the credentials, or the vsphere-cloud-config ones read with the reader
+func credentialsOrDefault(c *Credentials, reader client.Reader) *Credentials {
+	if c == nil {
+		return &Credentials{Reader: reader}
+	}
+	return c
+}
+
+// credentialsReason returns the CredentialsResolved condition reason of a Load error
+func credentialsReason(err error) string {
+	if errors.IsForbidden(err) {
+		return ReasonCredentialsForbidden
+	}
+	return ReasonCredentialsNotFound
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("vSphere credentials", func() {
+	var (
+		credentials *Credentials
+		cmap        *config.Mapper
+		o           *imagebuilderv1alpha1.OSImage
+	)
+
+	BeforeEach(func() {
+		reader := fake.NewClientBuilder().WithObjects(
+			&v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "vsphere-cloud-config", Namespace: TKG_NAMESPACE},
+				Data:       map[string]string{"vsphere.conf": configMapData},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "cloud-provider-vsphere-credentials", Namespace: "kube-system"},
+				Data: map[string][]byte{
+					"10.0.0.1.username": []byte("cpi"),
+					"10.0.0.1.password": []byte("cpi-password"),
+					"10.0.0.3.username": []byte("cpi-3"),
+					"10.0.0.3.password": []byte("cpi-3-password"),
+				},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "image-builder", Namespace: "default"},
+				Data: map[string][]byte{
+					CredentialsServerKey:     []byte("10.0.0.2"),
+					CredentialsUsernameKey:   []byte("builder"),
+					CredentialsPasswordKey:   []byte("builder-password"),
+					CredentialsThumbprintKey: []byte("AA:BB"),
+					CredentialsCABundleKey:   []byte("-----BEGIN CERTIFICATE-----"),
+				},
+			},
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "insecure", Namespace: "default"},
+				Data: map[string][]byte{
+					CredentialsServerKey:   []byte("10.0.0.2"),
+					CredentialsUsernameKey: []byte("builder"),
+					CredentialsPasswordKey: []byte("builder-password"),
+					CredentialsInsecureKey: []byte("yes"),
+				},
+			},
+		).Build()
+		credentials = &Credentials{Reader: reader, SecretReader: reader}
+		cmap = &config.Mapper{}
+		o = &imagebuilderv1alpha1.OSImage{ObjectMeta: metav1.ObjectMeta{Name: "windows", Namespace: "default"}}
+	})
+
+	It("should fall back to vsphere-cloud-config", func() {
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(BeNil())
+		Expect(cmap.Get(vsphere.VsphereServer)).To(Equal("10.0.0.1"))
+		Expect(cmap.Get(vsphere.VsphereUsername)).To(Equal("cpi"))
+		Expect(cmap.Get(vsphere.VsphereDataCenter)).To(Equal("/dc0"))
+		Expect(cmap.Get(vsphere.VsphereInsecure)).To(Equal("true"))
+	})
+	It("should verify the certificate with the thumbprint when the ca-file is not mounted", func() {
+		credentials.Reader = fake.NewClientBuilder().WithObjects(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsphere-cloud-config", Namespace: TKG_NAMESPACE},
+			Data: map[string]string{"vsphere.conf": `
+	[VirtualCenter "10.0.0.4"]
+		user = "cpi"
+		password = "cpi-password"
+		ca-file = "/etc/cloud/missing-ca.crt"
+		thumbprint = "AA:BB"
+`},
+		}).Build()
+		_, warning, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(BeNil())
+		Expect(warning).To(ContainSubstring("verified with the thumbprint"))
+		Expect(cmap.Get(vsphere.VsphereCABundle)).To(BeEmpty())
+		Expect(cmap.Get(vsphere.VsphereThumbprint)).To(Equal("AA:BB"))
+		Expect(cmap.Get(vsphere.VsphereInsecure)).To(Equal("false"))
+	})
+	It("should select the vsphere-cloud-config vCenter", func() {
+		o.Spec.VSphereServer = "10.0.0.3"
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(BeNil())
+		Expect(cmap.Get(vsphere.VsphereServer)).To(Equal("10.0.0.3"))
+		Expect(cmap.Get(vsphere.VsphereUsername)).To(Equal("cpi-3"))
+		Expect(cmap.Get(vsphere.VsphereDataCenter)).To(Equal("/dc1"))
+	})
+	It("should fail on a vCenter missing from vsphere-cloud-config", func() {
+		o.Spec.VSphereServer = "10.0.0.9"
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).NotTo(BeNil())
+	})
+	It("should fail on a credentials Secret of another vCenter", func() {
+		o.Spec.VSphereServer = "10.0.0.1"
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "image-builder"}
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(MatchError(ContainSubstring("is for vCenter 10.0.0.2")))
+	})
+	It("should use the OSImage credentials Secret", func() {
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "image-builder"}
+		source, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(BeNil())
+		Expect(source).To(Equal("secret default/image-builder"))
+		Expect(cmap.Get(vsphere.VsphereServer)).To(Equal("10.0.0.2"))
+		Expect(cmap.Get(vsphere.VsphereUsername)).To(Equal("builder"))
+		Expect(cmap.Get(vsphere.VsphereThumbprint)).To(Equal("AA:BB"))
+		Expect(cmap.Get(vsphere.VsphereCABundle)).To(Equal("-----BEGIN CERTIFICATE-----"))
+		Expect(cmap.Get(vsphere.VsphereInsecure)).To(Equal("false"))
+	})
+	It("should reject an invalid insecure key", func() {
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "insecure"}
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(MatchError(ContainSubstring("invalid insecure key")))
+	})
+	It("should use the default credentials Secret", func() {
+		credentials.DefaultSecret = &types.NamespacedName{Namespace: "default", Name: "image-builder"}
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(BeNil())
+		Expect(cmap.Get(vsphere.VsphereUsername)).To(Equal("builder"))
+	})
+	It("should fail on a Secret without password", func() {
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "cloud-provider-vsphere-credentials"}
+		o.Namespace = "kube-system"
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).NotTo(BeNil())
+	})
+	It("should report a forbidden credentials Secret", func() {
+		credentials.SecretReader = forbiddenReader{}
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "image-builder"}
+		_, _, err := credentials.Load(context.Background(), o, cmap)
+		Expect(err).To(MatchError(ContainSubstring("bind the tkw-credentials-reader ClusterRole in namespace default")))
+		Expect(credentialsReason(err)).To(Equal(ReasonCredentialsForbidden))
+	})
+})
+
+// forbiddenReader denies every read like a missing RoleBinding
+type forbiddenReader struct{}
+
+func (forbiddenReader) Get(_ context.Context, key client.ObjectKey, _ client.Object) error {
+	return errors.NewForbidden(v1.Resource("secrets"), key.Name, fmt.Errorf("no RoleBinding"))
+}
+
+func (forbiddenReader) List(context.Context, client.ObjectList, ...client.ListOption) error {
+	return errors.NewForbidden(v1.Resource("secrets"), "", fmt.Errorf("no RoleBinding"))
+}
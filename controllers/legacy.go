@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// legacyConfigMap is the ConfigMap rendered by the controller before the build Secret,
+// it holds windows.json with the vCenter username and password in plain text. It was
+// shared by all the OSImages and had no owner, so it is not garbage collected.
+var legacyConfigMap = client.ObjectKey{Namespace: "tkw-system", Name: "ib-windows"}
+
+//+kubebuilder:rbac:groups="",namespace=tkw-system,resources=configmaps,resourceNames=ib-windows,verbs=delete
+
+// LegacyCleanup deletes the resources left by previous controller versions once
+// the manager starts. It implements the Runnable interface.
+type LegacyCleanup struct {
+	Client client.Client
+}
+
+// Start deletes the legacy windows.json ConfigMap, failures are logged and do not
+// stop the manager.
+func (c *LegacyCleanup) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	cm := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: legacyConfigMap.Namespace, Name: legacyConfigMap.Name}}
+	if err := c.Client.Delete(ctx, cm); errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		logger.Error(err, "unable to delete the legacy windows.json configmap, delete it manually.", "configmap", legacyConfigMap)
+		return nil
+	}
+	logger.Info("Deleted the legacy windows.json configmap.", "configmap", legacyConfigMap)
+	return nil
+}
@@ -26,43 +26,95 @@ import (
 	"github.com/vmware/govmomi/vim25/mo"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"time"
 )
 
 const (
 	TKG_NAMESPACE = "kube-system"
 
-	ReasonCRNotAvailable         = "OperatorResourceNotAvailable"
-	ReasonDeploymentNotAvailable = "DeploymentNotAvailable"
-	ReasonSucceeded              = "OperatorSucceeded"
+	// publishRequeueInterval is the vSphere polling interval while publishing
+	publishRequeueInterval = 30 * time.Second
+	// preparingRequeueInterval is the polling interval of the resource bundle address
+	preparingRequeueInterval = 15 * time.Second
+
+	ReasonCRNotAvailable          = "OperatorResourceNotAvailable"
+	ReasonDeploymentNotAvailable  = "DeploymentNotAvailable"
+	ReasonVersionNotSupported     = "VersionNotSupported"
+	ReasonSucceeded               = "OperatorSucceeded"
+	ReasonReservedPackerVariables = "ReservedPackerVariables"
 )
 
 // OSImageReconciler reconciles a OSImage object
 type OSImageReconciler struct {
 	client.Client
-	Scheme      *runtime.Scheme
-	Credentials *config.Mapper
+	Scheme *runtime.Scheme
+
+	// Credentials loads the vSphere credentials, it defaults to the
+	// vsphere-cloud-config credentials read with the manager client.
+	Credentials *Credentials
+
+	// VSphereClients returns the vCenter clients, the vsphere.Sessions cache reuses
+	// the sessions across reconciles. It is required to connect to vCenter.
+	VSphereClients vsphere.ClientFactory
+
+	// APIReader lists the nodes and the build pods from the API server, so the manager
+	// does not cache every node and pod of the cluster. The client is used when nil.
+	APIReader client.Reader
+
+	// Recorder emits the OSImage Events, no Event is emitted when nil.
+	Recorder record.EventRecorder
+
+	// TemplateResyncInterval is the period between two listings of the vSphere
+	// templates of the OSImages without templateResyncInterval, zero disables it.
+	TemplateResyncInterval time.Duration
+
+	// TemplateWatcher reconciles the OSImages once their datacenter templates change
+	// in vCenter, the templates are only listed on resync when nil.
+	TemplateWatcher *TemplateWatcher
+
+	// BuildNamespace hosts the build resources of all OSImages, when empty
+	// they are created in the OSImage namespace.
+	BuildNamespace string
 }
 
 // todo(knabben): review the correct required RBACs
 //+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=osimages,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=osimages/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=osimages/finalizers,verbs=update
+//+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=osimagebuilds,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=osimagebuilds/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups="",resources=namespaces,verbs=create;get;list
-//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;read;list;watch;create
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;read;list;watch
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;read;list;watch
+// The build Secrets are managed with the Role of config/build, generated in the
+// --build-namespace, the credentials Secrets are read with the roles of config/rbac
+// and config/kube-system.
 //+kubebuilder:rbac:groups="",resources=services,verbs="*"
+//+kubebuilder:rbac:groups="",resources=pods,verbs=list
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=list
 //+kubebuilder:rbac:groups="apps",resources=deployments,verbs="*"
 //+kubebuilder:rbac:groups="batch",resources=jobs,verbs="*"
 
+// apiReader returns the reader of the objects not cached by the manager
+func (r *OSImageReconciler) apiReader() client.Reader {
+	if r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
 func (r *OSImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling object.", "req", req.NamespacedName)
@@ -75,105 +127,268 @@ func (r *OSImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, nil
 	} else if err != nil {
 		logger.Error(err, "Error getting object resource.")
-		meta.SetStatusCondition(&o.Status.Conditions, metav1.Condition{
-			Type:               "OperatorDegraded",
-			Status:             metav1.ConditionTrue,
-			Reason:             ReasonCRNotAvailable,
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Message:            fmt.Sprintf("unable to get CR: %s", err.Error()),
-		})
+		setCondition(&o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionTrue, ReasonCRNotAvailable,
+			fmt.Sprintf("unable to get CR: %s", err.Error()))
 		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.Status().Update(ctx, &o)})
 	}
 
-	if err := r.getCredentials(ctx, cmap); err != nil {
-		logger.Error(err, "unable to get configmap, create the required objects.")
+	// Build resources outside the OSImage namespace are not garbage collected.
+	if !o.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&o, BuildFinalizer) {
+			logger.Info("Deleting build resources.")
+			if err := r.deleteBuildResources(ctx, &o); err != nil {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(&o, BuildFinalizer)
+			return ctrl.Result{}, r.Update(ctx, &o)
+		}
 		return ctrl.Result{}, nil
 	}
+	if !controllerutil.ContainsFinalizer(&o, BuildFinalizer) {
+		controllerutil.AddFinalizer(&o, BuildFinalizer)
+		if err := r.Update(ctx, &o); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if o.Status.Phase == "" {
+		o.Status.Phase = imagebuilderv1alpha1.PhasePending
+	}
+
+	// Additional targets are built by OSImages owned by this one.
+	if err := r.reconcileTargets(ctx, &o); err != nil {
+		logger.Error(err, "unable to reconcile the additional targets")
+		setCondition(&o, imagebuilderv1alpha1.ConditionTargetsReady, metav1.ConditionFalse, ReasonTargetsNotReady,
+			fmt.Sprintf("unable to reconcile the additional targets: %s", err.Error()))
+		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.updateStatus(ctx, &o)})
+	}
+
+	source, warning, err := credentialsOrDefault(r.Credentials, r.Client).Load(ctx, &o, cmap)
+	if err != nil {
+		logger.Error(err, "unable to get credentials, create the required objects.")
+		o.Status.Phase = imagebuilderv1alpha1.PhasePending
+		setCondition(&o, imagebuilderv1alpha1.ConditionCredentialsResolved, metav1.ConditionFalse, credentialsReason(err),
+			fmt.Sprintf("unable to get vSphere credentials from %s: %s", source, err.Error()))
+		return ctrl.Result{}, r.updateStatus(ctx, &o)
+	}
+	if warning != "" {
+		setCondition(&o, imagebuilderv1alpha1.ConditionCredentialsResolved, metav1.ConditionTrue, ReasonCAFileNotMounted,
+			fmt.Sprintf("vSphere credentials loaded from %s, %s.", source, warning))
+	} else {
+		setCondition(&o, imagebuilderv1alpha1.ConditionCredentialsResolved, metav1.ConditionTrue, ReasonCredentialsResolved,
+			fmt.Sprintf("vSphere credentials loaded from %s.", source))
+	}
+
+	// Unknown versions have no resource bundle or target, so the build is never started.
+	release, err := windows.GetKubernetesRelease(o.Spec.KubernetesVersion)
+	var target *windows.OSTarget
+	if err == nil {
+		target, err = windows.GetOSTarget(o.Spec.WindowsVersion, o.Spec.WindowsEdition)
+	}
+	if err != nil {
+		logger.Error(err, "Version not supported.")
+		o.Status.Phase = imagebuilderv1alpha1.PhaseFailed
+		setCondition(&o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionTrue, ReasonVersionNotSupported, err.Error())
+		return ctrl.Result{}, r.updateStatus(ctx, &o)
+	}
+
+	// User overrides are applied after the controller defaults and discovered values. The
+	// packerVariablesRef ConfigMap is not validated by the webhook, a reserved variable
+	// fails the OSImage until the watched ConfigMap is fixed.
+	overrides, err := r.getPackerVariables(ctx, &o)
+	if err != nil {
+		logger.Error(err, "unable to get the packer variables")
+		setCondition(&o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionTrue, ReasonCRNotAvailable, err.Error())
+		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.updateStatus(ctx, &o)})
+	}
+	if reserved := windows.ReservedVariables(overrides...); len(reserved) > 0 {
+		o.Status.Phase = imagebuilderv1alpha1.PhaseFailed
+		setCondition(&o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionTrue, ReasonReservedPackerVariables,
+			fmt.Sprintf("the packer variables %v are set by the controller, remove them from configmap %s.", reserved, o.Spec.PackerVariablesRef.Name))
+		return ctrl.Result{}, r.updateStatus(ctx, &o)
+	}
+
+	// Omitted placement fields are resolved from the vSphere inventory.
+	if err := r.resolvePlacement(ctx, cmap, &o); err != nil {
+		logger.Error(err, "unable to resolve the vSphere placement")
+		setCondition(&o, imagebuilderv1alpha1.ConditionPlacementResolved, metav1.ConditionFalse, ReasonPlacementNotResolved,
+			fmt.Sprintf("unable to resolve the vSphere placement: %s", err.Error()))
+		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.updateStatus(ctx, &o)})
+	}
+	setCondition(&o, imagebuilderv1alpha1.ConditionPlacementResolved, metav1.ConditionTrue, ReasonPlacementResolved,
+		"vSphere placement resolved.")
 
 	logger.Info("Checking assets deployment and execute.")
-	if err := r.checkAssetsDeployment(ctx, cmap, &o); err != nil {
+	job, err := r.checkAssetsDeployment(ctx, cmap, release, target, &o, overrides)
+	if err == errPreflightFailed {
+		// The failures are listed in the PreflightFailed condition.
+		o.Status.Phase = imagebuilderv1alpha1.PhasePreparing
+		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.updateStatus(ctx, &o)})
+	} else if err != nil {
 		logger.Error(err, "Error getting assets objects.")
-		meta.SetStatusCondition(&o.Status.Conditions, metav1.Condition{
-			Type:               "OperatorDegraded",
-			Status:             metav1.ConditionTrue,
-			Reason:             ReasonDeploymentNotAvailable,
-			LastTransitionTime: metav1.NewTime(time.Now()),
-			Message:            fmt.Sprintf("unable to get deployment: %s", err.Error()),
-		})
-		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.Status().Update(ctx, &o)})
+		setCondition(&o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionTrue, ReasonDeploymentNotAvailable,
+			fmt.Sprintf("unable to get deployment: %s", err.Error()))
+		return ctrl.Result{}, utilerrors.NewAggregate([]error{err, r.updateStatus(ctx, &o)})
+	}
+
+	// The build waits for the resource bundle serving the artifacts, the
+	// Deployment is watched so its readiness triggers a new reconciliation,
+	// the Service address is polled.
+	if job == nil {
+		o.Status.Phase = imagebuilderv1alpha1.PhasePreparing
+		return ctrl.Result{RequeueAfter: preparingRequeueInterval}, r.updateStatus(ctx, &o)
+	}
+	setJobStatus(&o, job)
+	if o.Status.Phase == imagebuilderv1alpha1.PhaseFailed {
+		r.setBuildFailedCondition(ctx, &o, job)
 	}
 
 	// reconcile the status with the machine find
-	if err := r.reconcileStatus(ctx, &o, cmap); err != nil {
+	if err := r.reconcileStatus(ctx, &o, cmap, target, job); err != nil {
 		logger.Error(err, "unable to set OSImage object status")
 		return ctrl.Result{}, err
 	}
 
+	// Record the build attempt from the Job and template state.
+	if err := r.recordBuild(ctx, &o, job, release, target); err != nil {
+		logger.Error(err, "unable to record the OSImage build")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.updateStatus(ctx, &o); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Poll vSphere until the built template is published.
+	if o.Status.Phase == imagebuilderv1alpha1.PhasePublishing {
+		return ctrl.Result{RequeueAfter: publishRequeueInterval}, nil
+	}
+
+	// Templates are changed in vCenter by hand, list them again after the resync interval.
+	if left, ok := nextTemplateSync(&o, r.templateResyncInterval(&o), time.Now()); ok {
+		return ctrl.Result{RequeueAfter: left}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
-func (r *OSImageReconciler) checkAssetsDeployment(ctx context.Context, cmap *config.Mapper, imagebuilder *imagebuilderv1alpha1.OSImage) error {
+// checkAssetsDeployment creates the resource bundle and, once it is available,
+// the build Job. The returned Job is nil while the bundle is not ready.
+func (r *OSImageReconciler) checkAssetsDeployment(ctx context.Context, cmap *config.Mapper, release *windows.KubernetesRelease, target *windows.OSTarget, imagebuilder *imagebuilderv1alpha1.OSImage, overrides []map[string]string) (*batchv1.Job, error) {
 	logger := log.FromContext(ctx)
 
 	// Create the Windows resource bundle objects
-	wrb, err := r.getOrCreateWindowsResourceBundle(ctx, imagebuilder)
+	wrb, err := r.getOrCreateWindowsResourceBundle(ctx, release, imagebuilder)
+	if err != nil {
+		return nil, err
+	}
+	if !isDeploymentAvailable(wrb.Deployment) {
+		setCondition(imagebuilder, imagebuilderv1alpha1.ConditionResourceBundleReady, metav1.ConditionFalse, ReasonDeploymentNotAvailable,
+			fmt.Sprintf("deployment %s has no available replicas.", wrb.Deployment.Name))
+		return nil, nil
+	}
+
+	// The Packer VM can not resolve the cluster DNS, use an address reachable from vSphere.
+	bundleURL, err := r.resolveBundleURL(ctx, imagebuilder, wrb.Service)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	imagebuilder.Status.ResourceBundleStrategy = bundleAddressStrategy(imagebuilder)
+	imagebuilder.Status.ResourceBundleURL = bundleURL
+	if bundleURL == "" {
+		setCondition(imagebuilder, imagebuilderv1alpha1.ConditionResourceBundleReady, metav1.ConditionFalse, ReasonAddressNotAssigned,
+			fmt.Sprintf("service %s has no %s address assigned.", wrb.Service.Name, imagebuilder.Status.ResourceBundleStrategy))
+		return nil, nil
+	}
+	setCondition(imagebuilder, imagebuilderv1alpha1.ConditionResourceBundleReady, metav1.ConditionTrue, ReasonDeploymentAvailable,
+		fmt.Sprintf("deployment %s is available at %s.", wrb.Deployment.Name, bundleURL))
 
 	// Populate Windows configuration and save on a temporary file
 	logger.Info("Building windows.json file on memory.")
 
 	// Manage the configuration based on mgmt parameters and specs
-	// this configMap will be mounted in the Job as a volume.
-	settings, err := windows.NewWindowsSettings(
-		imagebuilder.Spec.WindowsISOPath,
-		imagebuilder.Spec.VMToolsPath,
-		wrb.Service.Name,
-		wrb.Service.Namespace,
-		wrb.Service.Spec.Ports[0].Port,
-		imagebuilder,
-	).GenerateJSONConfig(cmap)
+	// this secret will be mounted in the Job as a volume.
+	settings, hashSettings, err := renderBuildConfig(cmap, bundleURL, release, target, imagebuilder, overrides...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return r.getOrCreateWindowsImageBuilder(ctx, string(settings), imagebuilder)
+	return r.getOrCreateWindowsImageBuilder(ctx, cmap, settings, hashSettings, target, imagebuilder)
+}
+
+// renderBuildConfig renders the packer variables of the build, and the ones identifying
+// the build which are rendered without the resource bundle URL.
+func renderBuildConfig(cmap *config.Mapper, bundleURL string, release *windows.KubernetesRelease, target *windows.OSTarget, o *imagebuilderv1alpha1.OSImage, overrides ...map[string]string) (string, string, error) {
+	var rendered [2]string
+	for i, url := range []string{bundleURL, ""} {
+		settings, err := windows.NewWindowsSettings(o.Spec.WindowsISOPath, o.Spec.VMToolsPath, url, release, target, o).
+			GenerateJSONConfig(cmap, overrides...)
+		if err != nil {
+			return "", "", err
+		}
+		rendered[i] = string(settings)
+	}
+	return rendered[0], rendered[1], nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager, build resources are
+// mapped by annotation since they can live outside the OSImage namespace.
 func (r *OSImageReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&imagebuilderv1alpha1.OSImage{}).
-		Owns(&appsv1.Deployment{}).
-		Owns(&batchv1.Job{}).
-		Complete(r)
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(requestsForBuildObject)).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, handler.EnqueueRequestsFromMapFunc(requestsForBuildObject)).
+		Watches(&source.Kind{Type: &imagebuilderv1alpha1.OSImage{}}, handler.EnqueueRequestsFromMapFunc(requestsForParentOSImage)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.requestsForPackerVariables))
+	if r.TemplateWatcher != nil {
+		builder = builder.Watches(&source.Channel{Source: r.TemplateWatcher.Events}, &handler.EnqueueRequestForObject{})
+	}
+	return builder.Complete(r)
+}
+
+// templatesChanged returns true when the watcher saw a template change in the OSImage
+// datacenter since the last listing.
+func (r *OSImageReconciler) templatesChanged(o *imagebuilderv1alpha1.OSImage) bool {
+	p := o.Status.Placement
+	if r.TemplateWatcher == nil || p == nil || o.Status.LastTemplateSync == nil {
+		return false
+	}
+	return r.TemplateWatcher.ChangedSince(p.Server, p.Datacenter, o.Status.LastTemplateSync.Time)
 }
 
-func (r *OSImageReconciler) reconcileStatus(ctx context.Context, o *imagebuilderv1alpha1.OSImage, cmap *config.Mapper) error {
+// reconcileStatus lists the vSphere templates, they are listed again once the Job
+// succeeds to identify the template it published and after the resync interval.
+func (r *OSImageReconciler) reconcileStatus(ctx context.Context, o *imagebuilderv1alpha1.OSImage, cmap *config.Mapper, target *windows.OSTarget, job *batchv1.Job) error {
 	var vms []mo.VirtualMachine
+	var builtMoid string
 
-	if len(o.Status.OSTemplates) < 1 {
+	templateName := target.TemplateName(o.Spec.KubernetesVersion)
+	left, resync := nextTemplateSync(o, r.templateResyncInterval(o), time.Now())
+	if len(o.Status.OSTemplates) < 1 || o.Status.Phase == imagebuilderv1alpha1.PhasePublishing || (resync && left == 0) || r.templatesChanged(o) {
 		// Connect and filter DataCenter.
-		vc, dc, err := vsphere.ConnectFilterDC(ctx,
-			cmap.Get(vsphere.VsphereServer),
-			cmap.Get(vsphere.VsphereUsername),
-			cmap.Get(vsphere.VspherePassword),
-			cmap.Get(vsphere.VsphereDataCenter),
-		)
+		vc, dc, release, err := connect(ctx, r.VSphereClients, cmap)
 		if err != nil {
 			return err
 		}
+		defer release()
 
 		// Get templates from vSphere and DC.
 		if vms, err = vc.GetImportedVirtualMachinesImages(ctx, dc.Moid); err != nil {
 			return err
 		}
 
-		// Iterate on VMS and print table by VM
+		// Iterate on VMS and print table by VM, the template built by this
+		// object records the Windows version and edition from the spec.
 		var osTemplates = make([]imagebuilderv1alpha1.OSImageTemplates, len(vms))
 		for i, vm := range vms {
 			osTemplates[i].Name = vm.Name
+			osTemplates[i].Moid = vm.Self.Value
+			if vm.Parent != nil {
+				osTemplates[i].FolderMoid = vm.Parent.Value
+			}
+			if vm.Name == templateName {
+				osTemplates[i].WindowsVersion = target.Version
+				osTemplates[i].WindowsEdition = target.Edition
+			}
 			properties := vc.GetVMMetadata(&vm)
 			if properties != nil {
 				osTemplates[i].BuildDate = properties["BUILD_DATE"]
@@ -188,16 +403,21 @@ func (r *OSImageReconciler) reconcileStatus(ctx context.Context, o *imagebuilder
 				osTemplates[i].KubernetesSourceType = properties["KUBERNETES_SOURCE_TYPE"]
 			}
 		}
-		o.Status.OSTemplates = osTemplates
+		// The first listing has nothing to compare with.
+		if o.Status.LastTemplateSync != nil {
+			r.recordTemplateChanges(o, diffTemplates(o.Status.OSTemplates, osTemplates))
+		}
+		now := metav1.Now()
+		o.Status.OSTemplates, o.Status.LastTemplateSync = osTemplates, &now
+		builtMoid = builtTemplate(vms, templateName, job)
+		if !hasTemplate(osTemplates, o.Status.BuiltTemplateMoid) {
+			o.Status.BuiltTemplateMoid = ""
+		}
 	}
+	setTemplateStatus(o, templateName, builtMoid)
 
-	meta.SetStatusCondition(&o.Status.Conditions, metav1.Condition{
-		Type:               "OperatorDegraded",
-		Status:             metav1.ConditionFalse,
-		LastTransitionTime: metav1.NewTime(time.Now()),
-		Reason:             ReasonSucceeded,
-		Message:            "operator successfully reconciling.",
-	})
+	setCondition(o, imagebuilderv1alpha1.ConditionOperatorDegraded, metav1.ConditionFalse, ReasonSucceeded,
+		"operator successfully reconciling.")
 
-	return r.Status().Update(ctx, o)
+	return nil
 }
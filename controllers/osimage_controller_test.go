@@ -0,0 +1,444 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/fake"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fakeInventory returns a vCenter with a datacenter holding the placement objects,
+// the ISOs and the template built from windows 2019 core and Kubernetes v1.23.8.
+func fakeInventory() *fake.Client {
+	vc := fake.NewClient()
+	dc := vc.AddDatacenter("datacenter-2", "/dc0")
+	dc.Objects = []*models.VSphereManagementObject{
+		{Moid: "domain-c7", Name: "cluster0", Path: "/dc0/host/cluster0", ResourceType: models.VSphereManagementObjectResourceTypeCluster},
+		{Moid: "resgroup-8", Name: "Resources", Path: "/dc0/host/cluster0/Resources", ResourceType: models.VSphereManagementObjectResourceTypeRespool},
+		{Moid: "group-v3", Name: "vm", Path: "/dc0/vm", ResourceType: models.VSphereManagementObjectResourceTypeFolder},
+		{Moid: "network-9", Name: "VM Network", Path: "/dc0/network/VM Network", ResourceType: models.VSphereManagementObjectResourceTypeNetwork},
+		{Moid: "datastore-10", Name: "ds0", Path: "/dc0/datastore/ds0", ResourceType: models.VSphereManagementObjectResourceTypeDatastore},
+	}
+	dc.Capacities["datastore-10"] = vsphere.DatastoreCapacity{Capacity: 100 << 30, FreeSpace: 60 << 30}
+	dc.Files["ds0"] = []string{"win.iso", "vmtools.iso"}
+	dc.VirtualMachines = []mo.VirtualMachine{{
+		ManagedEntity: mo.ManagedEntity{
+			ExtensibleManagedObject: mo.ExtensibleManagedObject{Self: types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-42"}},
+			Name:                    "windows-2019-kube-v1.23.8",
+		},
+		Config: &types.VirtualMachineConfigInfo{
+			Template: true,
+			VAppConfig: &types.VmConfigInfo{Property: []types.VAppPropertyInfo{
+				{Key: 1, Id: "KUBERNETES_SEMVER", DefaultValue: "v1.23.8+vmware.2"},
+				{Key: 2, Id: "DISTRO_NAME", DefaultValue: "windows"},
+			}},
+		},
+	}}
+	return vc
+}
+
+var _ = Describe("OSImage reconciliation", func() {
+	var (
+		ctx        = context.Background()
+		reconciler *OSImageReconciler
+		vc         *fake.Client
+		namespace  string
+		o          *imagebuilderv1alpha1.OSImage
+	)
+
+	BeforeEach(func() {
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "osimage-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+
+		vc = fakeInventory()
+		reconciler = &OSImageReconciler{
+			Client:         k8sClient,
+			Scheme:         scheme.Scheme,
+			VSphereClients: fake.NewClientFactory("10.0.0.1", vc),
+		}
+
+		o = newOSImage("windows")
+		o.Namespace = namespace
+		o.Spec.ResourceBundleAddress = &imagebuilderv1alpha1.ResourceBundleAddress{
+			Strategy: imagebuilderv1alpha1.AddressOverride,
+			URL:      "http://10.0.0.50:8080",
+		}
+	})
+
+	AfterEach(func() {
+		// Every vCenter client taken by a reconcile is released.
+		Expect(reconciler.VSphereClients.(*fake.ClientFactory).Held()).To(BeZero())
+	})
+
+	createCredentials := func(data map[string]string) {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vsphere-credentials", Namespace: namespace},
+			Data:       map[string][]byte{},
+		}
+		for key, value := range data {
+			secret.Data[key] = []byte(value)
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: secret.Name}
+	}
+
+	reconcile := func() ctrl.Result {
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+		Expect(err).To(BeNil())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(o), o)).To(Succeed())
+		return result
+	}
+
+	// reconcilePreflightFailed reconciles an OSImage failing the preflight checks, the
+	// error retries them with the workqueue backoff.
+	reconcilePreflightFailed := func() {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+		Expect(err).To(MatchError(errPreflightFailed))
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(o), o)).To(Succeed())
+		Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhasePreparing))
+	}
+
+	// makeBundleAvailable reports the resource bundle Deployment rolled out
+	makeBundleAvailable := func() {
+		deployment := &appsv1.Deployment{}
+		key := client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixResourceKit)}
+		Expect(k8sClient.Get(ctx, key, deployment)).To(Succeed())
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		}
+		Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+	}
+
+	It("should wait for the vsphere-cloud-config", func() {
+		Expect(k8sClient.Create(ctx, o)).To(Succeed())
+		reconcile()
+
+		Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhasePending))
+		condition := meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionCredentialsResolved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(ReasonCredentialsNotFound))
+		Expect(condition.Message).To(ContainSubstring("vsphere-cloud-config"))
+	})
+
+	It("should report a malformed credentials Secret", func() {
+		createCredentials(map[string]string{"server": "10.0.0.1", "username": "administrator@vsphere.local"})
+		Expect(k8sClient.Create(ctx, o)).To(Succeed())
+		reconcile()
+
+		condition := meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionCredentialsResolved)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Message).To(ContainSubstring("has no password key"))
+		Expect(vc.Calls()).To(BeEmpty())
+	})
+
+	Describe("with valid credentials", func() {
+		BeforeEach(func() {
+			createCredentials(map[string]string{
+				"server":     "10.0.0.1",
+				"username":   "administrator@vsphere.local",
+				"password":   "secret",
+				"datacenter": "dc0",
+			})
+			Expect(k8sClient.Create(ctx, o)).To(Succeed())
+		})
+
+		It("should create the resource bundle and resolve the placement", func() {
+			result := reconcile()
+			Expect(result.RequeueAfter).To(Equal(preparingRequeueInterval))
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhasePreparing))
+			Expect(o.Finalizers).To(ContainElement(BuildFinalizer))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixResourceKit)}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue(LabelOSImageUID, string(o.UID)))
+			Expect(metav1.IsControlledBy(deployment, o)).To(BeTrue())
+
+			service := &v1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixResource)}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(LabelOSImageUID, string(o.UID)))
+			Expect(service.Spec.Type).To(Equal(v1.ServiceTypeClusterIP))
+
+			Expect(o.Status.Placement).To(Equal(&imagebuilderv1alpha1.OSImagePlacement{
+				Server:       "10.0.0.1",
+				Datacenter:   "/dc0",
+				Folder:       "/dc0/vm",
+				Datastore:    "/dc0/datastore/ds0",
+				Network:      "/dc0/network/VM Network",
+				ResourcePool: "/dc0/host/cluster0/Resources",
+				Cluster:      "/dc0/host/cluster0",
+			}))
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionResourceBundleReady)).To(BeTrue())
+		})
+
+		It("should create the build Job with the rendered windows.json", func() {
+			reconcile()
+			makeBundleAvailable()
+			reconcile()
+
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseBuilding))
+			Expect(o.Status.ResourceBundleURL).To(Equal("http://10.0.0.50:8080"))
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionPreflightFailed)).To(BeTrue())
+
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixJob)}, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"build-node-ova-vsphere-windows-2019"}))
+			Expect(job.Annotations).To(HaveKeyWithValue(AnnotationBuildHash, o.Status.BuildHash))
+
+			secret := &v1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixSecret)}, secret)).To(Succeed())
+			variables := map[string]string{}
+			Expect(json.Unmarshal(secret.Data["windows.json"], &variables)).To(Succeed())
+			Expect(variables).To(HaveKeyWithValue("vcenter_server", "10.0.0.1"))
+			Expect(variables).To(HaveKeyWithValue("username", "administrator@vsphere.local"))
+			Expect(variables).To(HaveKeyWithValue("datacenter", "/dc0"))
+			Expect(variables).To(HaveKeyWithValue("datastore", "/dc0/datastore/ds0"))
+			Expect(variables).To(HaveKeyWithValue("cluster", "/dc0/host/cluster0"))
+			Expect(variables).To(HaveKeyWithValue("os_iso_path", "[ds0] ./win.iso"))
+			Expect(variables).To(HaveKeyWithValue("vmtools_iso_path", "[ds0] ./vmtools.iso"))
+			Expect(variables).To(HaveKeyWithValue("kubernetes_base_url", "http://10.0.0.50:8080/files/kubernetes/"))
+			Expect(variables).To(HaveKeyWithValue("build_name", "windows-2019"))
+		})
+
+		It("should fail the preflight checks of missing ISOs", func() {
+			vc.Inventory["datacenter-2"].Files["ds0"] = []string{"vmtools.iso"}
+			reconcile()
+			makeBundleAvailable()
+			reconcilePreflightFailed()
+
+			condition := meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionPreflightFailed)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring("windowsISOPath file win.iso not found"))
+
+			jobs := &batchv1.JobList{}
+			Expect(k8sClient.List(ctx, jobs, client.InNamespace(namespace))).To(Succeed())
+			Expect(jobs.Items).To(BeEmpty())
+		})
+
+		It("should look up datastore paths in their datastore and folder", func() {
+			o.Spec.WindowsISOPath = "[iso0] isos/win.iso"
+			Expect(k8sClient.Update(ctx, o)).To(Succeed())
+			reconcile()
+			makeBundleAvailable()
+			reconcilePreflightFailed()
+
+			condition := meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionPreflightFailed)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring(`windowsISOPath datastore "iso0" not found`))
+
+			dc := vc.Inventory["datacenter-2"]
+			dc.Objects = append(dc.Objects, &models.VSphereManagementObject{
+				Moid: "datastore-11", Name: "iso0", Path: "/dc0/datastore/iso0", ResourceType: models.VSphereManagementObjectResourceTypeDatastore,
+			})
+			dc.Files["iso0"] = []string{"win.iso"}
+			reconcilePreflightFailed()
+			condition = meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionPreflightFailed)
+			Expect(condition.Message).To(ContainSubstring("windowsISOPath file isos/win.iso not found in datastore iso0"))
+
+			dc.Files["iso0"] = []string{"isos/win.iso"}
+			reconcile()
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseBuilding))
+
+			secret := &v1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixSecret)}, secret)).To(Succeed())
+			variables := map[string]string{}
+			Expect(json.Unmarshal(secret.Data["windows.json"], &variables)).To(Succeed())
+			Expect(variables).To(HaveKeyWithValue("os_iso_path", "[iso0] ./isos/win.iso"))
+			Expect(variables).To(HaveKeyWithValue("vmtools_iso_path", "[ds0] ./vmtools.iso"))
+		})
+
+		// finishJob starts the build Job at startTime and sets its final condition
+		finishJob := func(startTime time.Time, conditionType batchv1.JobConditionType, reason, message string) *batchv1.Job {
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: buildObjectName(o, suffixJob)}, job)).To(Succeed())
+			start, now := metav1.NewTime(startTime), metav1.NewTime(time.Now())
+			job.Status = batchv1.JobStatus{
+				StartTime: &start,
+				Conditions: []batchv1.JobCondition{{
+					Type: conditionType, Status: v1.ConditionTrue, Reason: reason, Message: message, LastTransitionTime: now,
+				}},
+			}
+			if conditionType == batchv1.JobComplete {
+				job.Status.CompletionTime = &now
+				job.Status.Succeeded = 1
+			} else {
+				job.Status.Failed = 1
+			}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+			return job
+		}
+
+		It("should populate the templates from the vSphere inventory", func() {
+			reconcile()
+			makeBundleAvailable()
+			reconcile()
+
+			finishJob(time.Now(), batchv1.JobComplete, "", "")
+			reconcile()
+
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseSucceeded))
+			Expect(o.Status.BuiltTemplateMoid).To(Equal("vm-42"))
+			Expect(o.Status.OSTemplates).To(HaveLen(1))
+			template := o.Status.OSTemplates[0]
+			Expect(template.Name).To(Equal("windows-2019-kube-v1.23.8"))
+			Expect(template.Moid).To(Equal("vm-42"))
+			Expect(template.KubernetesSemVer).To(Equal("v1.23.8+vmware.2"))
+			Expect(template.DistroName).To(Equal("windows"))
+			Expect(template.WindowsVersion).To(Equal("2019"))
+			Expect(meta.IsStatusConditionTrue(o.Status.Conditions, imagebuilderv1alpha1.ConditionTemplateAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionBuildFailed)).To(BeTrue())
+		})
+
+		It("should resync the templates and emit an Event per change", func() {
+			recorder := record.NewFakeRecorder(10)
+			reconciler.Recorder = recorder
+			reconciler.TemplateResyncInterval = time.Hour
+
+			reconcile()
+			makeBundleAvailable()
+			reconcile()
+			finishJob(time.Now(), batchv1.JobComplete, "", "")
+			result := reconcile()
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseSucceeded))
+			Expect(o.Status.LastTemplateSync).NotTo(BeNil())
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			Expect(recorder.Events).To(BeEmpty())
+
+			// The built template is renamed and another image is imported in vCenter.
+			dc := vc.Inventory["datacenter-2"]
+			dc.VirtualMachines[0].Name = "windows-2019"
+			dc.VirtualMachines = append(dc.VirtualMachines, mo.VirtualMachine{
+				ManagedEntity: mo.ManagedEntity{
+					ExtensibleManagedObject: mo.ExtensibleManagedObject{Self: types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-50"}},
+					Name:                    "ubuntu-2004-kube-v1.23.8",
+				},
+				Config: &types.VirtualMachineConfigInfo{Template: true},
+			})
+
+			// Nothing is listed before the interval.
+			reconcile()
+			Expect(o.Status.OSTemplates).To(HaveLen(1))
+
+			expired := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+			o.Status.LastTemplateSync = &expired
+			Expect(k8sClient.Status().Update(ctx, o)).To(Succeed())
+			reconcile()
+
+			Expect(o.Status.OSTemplates).To(HaveLen(2))
+			Expect(o.Status.LastTemplateSync.After(expired.Time)).To(BeTrue())
+			Expect(o.Status.BuiltTemplateMoid).To(Equal("vm-42"))
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionTemplateAvailable)).To(BeTrue())
+			Expect(recorder.Events).To(HaveLen(2))
+			Expect(<-recorder.Events).To(Equal("Normal TemplateChanged template windows-2019 (vm-42) changed in vSphere: renamed from windows-2019-kube-v1.23.8."))
+			Expect(<-recorder.Events).To(Equal("Normal TemplateAdded template ubuntu-2004-kube-v1.23.8 (vm-50) added in vSphere."))
+
+			// The built template is deleted.
+			dc.VirtualMachines = dc.VirtualMachines[1:]
+			o.Status.LastTemplateSync = &expired
+			Expect(k8sClient.Status().Update(ctx, o)).To(Succeed())
+			reconcile()
+
+			Expect(o.Status.BuiltTemplateMoid).To(BeEmpty())
+			Expect(<-recorder.Events).To(Equal("Warning TemplateRemoved template windows-2019 (vm-42) removed from vSphere."))
+		})
+
+		It("should wait for the template published by the build Job", func() {
+			dc := vc.Inventory["datacenter-2"]
+			stale := time.Now().Add(-time.Hour)
+			dc.VirtualMachines[0].Config.CreateDate = &stale
+
+			reconcile()
+			makeBundleAvailable()
+			reconcile()
+			Expect(o.Status.OSTemplates).To(HaveLen(1))
+
+			start := time.Now().Add(-10 * time.Minute)
+			finishJob(start, batchv1.JobComplete, "", "")
+			reconcile()
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhasePublishing))
+			Expect(o.Status.BuiltTemplateMoid).To(BeEmpty())
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionTemplateAvailable)).To(BeTrue())
+
+			// The build replaced the template of the previous build.
+			created := start.Add(5 * time.Minute)
+			dc.VirtualMachines[0].Self.Value = "vm-43"
+			dc.VirtualMachines[0].Config.CreateDate = &created
+			reconcile()
+
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseSucceeded))
+			Expect(o.Status.BuiltTemplateMoid).To(Equal("vm-43"))
+			Expect(o.Status.OSTemplates[0].Moid).To(Equal("vm-43"))
+			Expect(o.Status.Targets[0].TemplateMoid).To(Equal("vm-43"))
+
+			build := &imagebuilderv1alpha1.OSImageBuild{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: o.Status.LatestBuild}, build)).To(Succeed())
+			Expect(build.Status.TemplateMoid).To(Equal("vm-43"))
+		})
+
+		It("should report the failure reason and the build pod", func() {
+			reconcile()
+			makeBundleAvailable()
+			reconcile()
+
+			job := finishJob(time.Now(), batchv1.JobFailed, "BackoffLimitExceeded", "Job has reached the specified backoff limit")
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      job.Name + "-x7k2p",
+					Namespace: namespace,
+					Labels:    map[string]string{"job-name": job.Name},
+				},
+				Spec: *job.Spec.Template.Spec.DeepCopy(),
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			reconcile()
+
+			Expect(o.Status.Phase).To(Equal(imagebuilderv1alpha1.PhaseFailed))
+			condition := meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionBuildFailed)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("BackoffLimitExceeded"))
+			Expect(condition.Message).To(ContainSubstring("Job has reached the specified backoff limit"))
+			Expect(condition.Message).To(HaveSuffix("run kubectl logs -n " + namespace + " " + pod.Name + " for the build logs"))
+
+			// The pods are listed once per generation.
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+			reconcile()
+			condition = meta.FindStatusCondition(o.Status.Conditions, imagebuilderv1alpha1.ConditionBuildFailed)
+			Expect(condition.Message).To(ContainSubstring(pod.Name))
+		})
+
+		It("should report an unreachable vCenter", func() {
+			reconciler.VSphereClients = fake.NewClientFactory("10.0.0.2", vc)
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(o)})
+			Expect(err).To(MatchError(ContainSubstring("vCenter 10.0.0.1 is unreachable")))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(o), o)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionPlacementResolved)).To(BeTrue())
+		})
+	})
+})
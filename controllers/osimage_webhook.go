@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/windows"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// OSImageValidator validates the OSImage spec at admission time
+type OSImageValidator struct {
+	Client client.Reader
+}
+
+//+kubebuilder:webhook:path=/validate-imagebuilder-tanzu-opssec-in-v1alpha1-osimage,mutating=false,failurePolicy=fail,sideEffects=None,groups=imagebuilder.tanzu.opssec.in,resources=osimages,verbs=create;update,versions=v1alpha1,name=vosimage.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &OSImageValidator{}
+
+// SetupWebhookWithManager registers the validating webhook with the Manager.
+func (v *OSImageValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1alpha1.OSImage{}).
+		WithValidator(v).
+		Complete()
+}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *OSImageValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	o, ok := obj.(*v1alpha1.OSImage)
+	if !ok {
+		return fmt.Errorf("expected an OSImage but got a %T", obj)
+	}
+	allErrs := validateOSImageSpec(o)
+	if len(allErrs) == 0 {
+		allErrs = append(allErrs, v.validateTemplateName(ctx, o)...)
+	}
+	return toInvalidError(o, allErrs)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *OSImageValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	o, ok := newObj.(*v1alpha1.OSImage)
+	if !ok {
+		return fmt.Errorf("expected an OSImage but got a %T", newObj)
+	}
+	old, ok := oldObj.(*v1alpha1.OSImage)
+	if !ok {
+		return fmt.Errorf("expected an OSImage but got a %T", oldObj)
+	}
+	// Deleted objects only get their finalizers removed.
+	if !o.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	allErrs := validateOSImageSpec(o)
+	allErrs = append(allErrs, validateImmutableFields(old, o)...)
+	if len(allErrs) == 0 {
+		allErrs = append(allErrs, v.validateTemplateName(ctx, o)...)
+	}
+	return toInvalidError(o, allErrs)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *OSImageValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// validateOSImageSpec checks the ISO paths and the versions have a build target
+func validateOSImageSpec(o *v1alpha1.OSImage) field.ErrorList {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateISOPath(specPath.Child("windowsISOPath"), o.Spec.WindowsISOPath)...)
+	allErrs = append(allErrs, validateISOPath(specPath.Child("vmtoolsPath"), o.Spec.VMToolsPath)...)
+
+	if _, err := windows.GetKubernetesRelease(o.Spec.KubernetesVersion); err != nil {
+		allErrs = append(allErrs, field.NotSupported(specPath.Child("kubernetesVersion"),
+			o.Spec.KubernetesVersion, windows.SupportedKubernetesVersions()))
+	}
+	if _, err := windows.GetOSTarget(o.Spec.WindowsVersion, o.Spec.WindowsEdition); err != nil {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("windowsVersion"), o.Spec.WindowsVersion, err.Error()))
+	}
+	for _, key := range windows.ReservedVariables(o.Spec.PackerVariables) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("packerVariables").Key(key),
+			"the variable is set by the controller from the credentials and the template name"))
+	}
+	if interval := o.Spec.TemplateResyncInterval; interval != nil && interval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("templateResyncInterval"), interval.Duration.String(), "must not be negative"))
+	}
+	return append(allErrs, validateAdditionalTargets(specPath.Child("additionalTargets"), o)...)
+}
+
+// validateAdditionalTargets requires a vCenter per target, each vCenter datacenter is
+// built once. The defaulted vCenter and datacenter of the OSImage are taken from its
+// placement once resolved, the controller skips the targets matching them before.
+func validateAdditionalTargets(fldPath *field.Path, o *v1alpha1.OSImage) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := targetKeys(o)
+	for i, target := range o.Spec.AdditionalTargets {
+		if target.Server == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i).Child("server"), "the vCenter server is required"))
+			continue
+		}
+		key := target.Server + datacenterPath(target.Datacenter)
+		if seen[key] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), key))
+		}
+		seen[key] = true
+	}
+	return allErrs
+}
+
+// validateISOPath accepts a datastore path or a path looked up on the root of the
+// build datastore. URLs are rejected: the image-builder Windows template passes
+// the ISOs to Packer as datastore paths and has no download step, supporting them
+// would mean uploading the ISOs to the datastore on every build.
+func validateISOPath(fldPath *field.Path, isoPath string) field.ErrorList {
+	var allErrs field.ErrorList
+	if isoPath == "" {
+		return append(allErrs, field.Required(fldPath, "the ISO path is required"))
+	}
+	if u, err := url.Parse(isoPath); err == nil && u.Scheme != "" && u.Host != "" {
+		return append(allErrs, field.Invalid(fldPath, isoPath,
+			fmt.Sprintf("%s URLs are not supported, upload the ISO to the datastore", u.Scheme)))
+	}
+	if strings.HasPrefix(isoPath, "[") && !windows.DatastorePathRegex.MatchString(isoPath) {
+		allErrs = append(allErrs, field.Invalid(fldPath, isoPath, "datastore paths must look like \"[datastore] folder/file.iso\""))
+	}
+	if !strings.HasSuffix(strings.ToLower(isoPath), ".iso") {
+		allErrs = append(allErrs, field.Invalid(fldPath, isoPath, "the path must point to an .iso file"))
+	}
+	return allErrs
+}
+
+// mutableSpecFields are the spec fields, by JSON name, that do not change the inputs or
+// the destination of a running build. Every other field, including the new ones, is
+// a build input.
+var mutableSpecFields = map[string]bool{
+	"buildHistoryLimit":      true,
+	"templateResyncInterval": true,
+}
+
+// validateImmutableFields rejects changes on the build inputs while a build is running
+func validateImmutableFields(old, o *v1alpha1.OSImage) field.ErrorList {
+	var allErrs field.ErrorList
+	if !isBuildRunning(old) {
+		return allErrs
+	}
+
+	specPath := field.NewPath("spec")
+	oldSpec, newSpec := reflect.ValueOf(old.Spec), reflect.ValueOf(o.Spec)
+	specType := oldSpec.Type()
+	for i := 0; i < specType.NumField(); i++ {
+		name := strings.Split(specType.Field(i).Tag.Get("json"), ",")[0]
+		if mutableSpecFields[name] {
+			continue
+		}
+		if !reflect.DeepEqual(oldSpec.Field(i).Interface(), newSpec.Field(i).Interface()) {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child(name),
+				fmt.Sprintf("the field can not be changed while the build is %s", old.Status.Phase)))
+		}
+	}
+	return allErrs
+}
+
+// validateTemplateName rejects OSImages producing the template of another OSImage in
+// the same vCenter, datacenter and folder
+func (v *OSImageValidator) validateTemplateName(ctx context.Context, o *v1alpha1.OSImage) field.ErrorList {
+	var allErrs field.ErrorList
+	templateName := osImageTemplateName(o)
+
+	images := &v1alpha1.OSImageList{}
+	if err := v.Client.List(ctx, images); err != nil {
+		return append(allErrs, field.InternalError(field.NewPath("metadata"), err))
+	}
+	for i := range images.Items {
+		other := &images.Items[i]
+		if other.Namespace == o.Namespace && other.Name == o.Name {
+			continue
+		}
+		if osImageTemplateName(other) == templateName && sameLocation(o, other) {
+			_, location := osImageLocation(other)
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("spec", "kubernetesVersion"),
+				fmt.Sprintf("template %s in folder %q of vCenter %q is built by %s/%s",
+					templateName, location[2], location[0], other.Namespace, other.Name)))
+		}
+	}
+	return allErrs
+}
+
+// osImageTemplateName returns the name of the template built by the OSImage
+func osImageTemplateName(o *v1alpha1.OSImage) string {
+	target, err := windows.GetOSTarget(o.Spec.WindowsVersion, o.Spec.WindowsEdition)
+	if err != nil {
+		return ""
+	}
+	return target.TemplateName(o.Spec.KubernetesVersion)
+}
+
+// osImageLocation returns the vCenter, datacenter and folder of the template from
+// the spec, and with the resolved placement used for the fields omitted from the spec.
+func osImageLocation(o *v1alpha1.OSImage) (spec, resolved []string) {
+	spec = []string{o.Spec.VSphereServer, datacenterPath(o.Spec.VsphereDatacenter), o.Spec.VSphereFolder}
+	resolved = append([]string{}, spec...)
+	if p := o.Status.Placement; p != nil {
+		resolved[0] = firstNonEmpty(resolved[0], p.Server)
+		resolved[1] = firstNonEmpty(resolved[1], p.Datacenter)
+		resolved[2] = firstNonEmpty(resolved[2], p.Folder)
+	}
+	return spec, resolved
+}
+
+// sameLocation returns true when both OSImages publish their template in the same
+// vCenter, datacenter and folder
+func sameLocation(a, b *v1alpha1.OSImage) bool {
+	specA, resolvedA := osImageLocation(a)
+	specB, resolvedB := osImageLocation(b)
+	for i := range specA {
+		if resolvedA[i] != "" && resolvedB[i] != "" {
+			if resolvedA[i] != resolvedB[i] {
+				return false
+			}
+			continue
+		}
+		// A value not resolved yet defaults like the other omitted values.
+		if specA[i] != specB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toInvalidError(o *v1alpha1.OSImage, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind("OSImage").GroupKind(), o.Name, allErrs)
+}
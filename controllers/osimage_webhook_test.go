@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newOSImage(name string) *imagebuilderv1alpha1.OSImage {
+	return &imagebuilderv1alpha1.OSImage{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: imagebuilderv1alpha1.OSImageSpec{
+			WindowsISOPath:    "./isos/win.iso",
+			VMToolsPath:       "./isos/vmtools.iso",
+			KubernetesVersion: "v1.23.8",
+			WindowsVersion:    "2019",
+			WindowsEdition:    "core",
+		},
+	}
+}
+
+var _ = Describe("OSImage validating webhook", func() {
+	Describe("Validating the ISO paths", func() {
+		path := field.NewPath("spec", "windowsISOPath")
+		DescribeTable("should accept datastore paths",
+			func(isoPath string) {
+				Expect(validateISOPath(path, isoPath)).To(BeEmpty())
+			},
+			Entry("relative path", "./isos/win.iso"),
+			Entry("file name", "win.iso"),
+			Entry("datastore path", "[sharedVmfs-0] isos/WIN.ISO"),
+		)
+		DescribeTable("should reject invalid paths",
+			func(isoPath string) {
+				Expect(validateISOPath(path, isoPath)).NotTo(BeEmpty())
+			},
+			Entry("empty path", ""),
+			Entry("URL", "https://example.com/win.iso"),
+			Entry("datastore without path", "[sharedVmfs-0]"),
+			Entry("not an ISO", "./isos/win.vmdk"),
+		)
+	})
+
+	Describe("Validating the spec", func() {
+		It("should reject an unsupported Kubernetes version", func() {
+			o := newOSImage("windows")
+			o.Spec.KubernetesVersion = "v1.0.0"
+			errs := validateOSImageSpec(o)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.kubernetesVersion"))
+		})
+		It("should reject duplicated additional targets", func() {
+			o := newOSImage("windows")
+			o.Spec.AdditionalTargets = []imagebuilderv1alpha1.VSphereTarget{
+				{Server: "10.0.0.2", Datacenter: "dc0"},
+				{Server: "10.0.0.2", Datacenter: "/dc0"},
+				{Datacenter: "/dc0"},
+			}
+			errs := validateOSImageSpec(o)
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Type).To(Equal(field.ErrorTypeDuplicate))
+			Expect(errs[1].Field).To(Equal("spec.additionalTargets[2].server"))
+		})
+		It("should reject the additional targets of the resolved vCenter datacenter", func() {
+			o := newOSImage("windows")
+			o.Spec.AdditionalTargets = []imagebuilderv1alpha1.VSphereTarget{{Server: "10.0.0.1", Datacenter: "dc0"}}
+			Expect(validateOSImageSpec(o)).To(BeEmpty())
+
+			o.Status.Placement = &imagebuilderv1alpha1.OSImagePlacement{Server: "10.0.0.1", Datacenter: "/dc0"}
+			errs := validateOSImageSpec(o)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Type).To(Equal(field.ErrorTypeDuplicate))
+		})
+		It("should reject a negative template resync interval", func() {
+			o := newOSImage("windows")
+			o.Spec.TemplateResyncInterval = &metav1.Duration{Duration: -time.Minute}
+			errs := validateOSImageSpec(o)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("spec.templateResyncInterval"))
+		})
+		It("should reject the packer variables set by the controller", func() {
+			o := newOSImage("windows")
+			o.Spec.PackerVariables = map[string]string{"unattend_timezone": "UTC", "vcenter_server": "10.0.0.9"}
+			errs := validateOSImageSpec(o)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+			Expect(errs[0].Field).To(Equal("spec.packerVariables[vcenter_server]"))
+		})
+	})
+
+	Describe("Updating a building OSImage", func() {
+		var old, o *imagebuilderv1alpha1.OSImage
+
+		BeforeEach(func() {
+			old = newOSImage("windows")
+			old.Status.Phase = imagebuilderv1alpha1.PhaseBuilding
+			o = old.DeepCopy()
+		})
+
+		It("should reject build input changes", func() {
+			o.Spec.VSphereDataStore = "/dc0/datastore/other"
+			errs := validateImmutableFields(old, o)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		})
+		It("should reject the changes of the build destination and credentials", func() {
+			o.Spec.AdditionalTargets = []imagebuilderv1alpha1.VSphereTarget{{Server: "10.0.0.2"}}
+			o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "image-builder"}
+			o.Spec.ResourceBundleAddress = &imagebuilderv1alpha1.ResourceBundleAddress{Strategy: imagebuilderv1alpha1.AddressOverride}
+			errs := validateImmutableFields(old, o)
+			Expect(errs).To(HaveLen(3))
+			Expect(errs[0].Field).To(Equal("spec.credentialsRef"))
+			Expect(errs[1].Field).To(Equal("spec.resourceBundleAddress"))
+			Expect(errs[2].Field).To(Equal("spec.additionalTargets"))
+		})
+		It("should accept the other fields", func() {
+			limit := int32(2)
+			o.Spec.BuildHistoryLimit = &limit
+			o.Spec.TemplateResyncInterval = &metav1.Duration{Duration: time.Hour}
+			Expect(validateImmutableFields(old, o)).To(BeEmpty())
+		})
+		It("should accept any change once the build is finished", func() {
+			old.Status.Phase = imagebuilderv1alpha1.PhaseSucceeded
+			o.Spec.KubernetesVersion = "v1.24.0"
+			Expect(validateImmutableFields(old, o)).To(BeEmpty())
+		})
+	})
+
+	Describe("Creating an OSImage", func() {
+		var (
+			existing  *imagebuilderv1alpha1.OSImage
+			validator *OSImageValidator
+		)
+
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(imagebuilderv1alpha1.AddToScheme(scheme)).To(Succeed())
+			existing = newOSImage("existing")
+			existing.Status.Placement = &imagebuilderv1alpha1.OSImagePlacement{Server: "10.0.0.1", Folder: "/dc0/vm"}
+			validator = &OSImageValidator{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build(),
+			}
+		})
+
+		It("should reject a template built by another OSImage in the folder", func() {
+			err := validator.ValidateCreate(context.Background(), newOSImage("windows"))
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+		It("should accept the template in another folder", func() {
+			o := newOSImage("windows")
+			o.Spec.VSphereFolder = "/dc0/vm/windows"
+			Expect(validator.ValidateCreate(context.Background(), o)).To(Succeed())
+		})
+		It("should accept the template in another vCenter", func() {
+			o := newOSImage("windows")
+			o.Spec.VSphereServer = "10.0.0.2"
+			Expect(validator.ValidateCreate(context.Background(), o)).To(Succeed())
+		})
+		It("should accept another Windows edition", func() {
+			o := newOSImage("windows")
+			o.Spec.WindowsEdition = "desktop"
+			Expect(validator.ValidateCreate(context.Background(), o)).To(Succeed())
+		})
+	})
+})
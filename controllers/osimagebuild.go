@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/windows"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultBuildHistoryLimit is the number of OSImageBuild records kept when unset
+const DefaultBuildHistoryLimit = 5
+
+// recordBuild creates or updates the OSImageBuild of the current build number,
+// running records of older builds are superseded and the history is pruned.
+func (r *OSImageReconciler) recordBuild(ctx context.Context, o *v1alpha1.OSImage, job *batchv1.Job, release *windows.KubernetesRelease, target *windows.OSTarget) error {
+	builds := &v1alpha1.OSImageBuildList{}
+	if err := r.List(ctx, builds, client.InNamespace(o.Namespace), client.MatchingLabels{LabelOSImageUID: string(o.UID)}); err != nil {
+		return err
+	}
+
+	var current *v1alpha1.OSImageBuild
+	for i := range builds.Items {
+		build := &builds.Items[i]
+		if build.Spec.BuildNumber == o.Status.BuildNumber {
+			current = build
+			continue
+		}
+		if build.Status.Result == v1alpha1.BuildRunning {
+			now := metav1.Now()
+			build.Status.Result = v1alpha1.BuildSuperseded
+			build.Status.CompletionTime = &now
+			if err := r.Status().Update(ctx, build); err != nil {
+				return err
+			}
+		}
+	}
+
+	if current == nil {
+		current = &v1alpha1.OSImageBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      buildObjectName(o, fmt.Sprintf("build-%d", o.Status.BuildNumber)),
+				Namespace: o.Namespace,
+				Labels:    map[string]string{LabelOSImageUID: string(o.UID)},
+			},
+			Spec: v1alpha1.OSImageBuildSpec{
+				OSImageName:       o.Name,
+				BuildNumber:       o.Status.BuildNumber,
+				InputHash:         o.Status.BuildHash,
+				ImageBuilderImage: job.Spec.Template.Spec.Containers[0].Image,
+				BundleImage:       release.BundleImage,
+				TemplateName:      target.TemplateName(o.Spec.KubernetesVersion),
+			},
+		}
+		if err := ctrl.SetControllerReference(o, current, r.Scheme); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("Recording build.", "build", current.Name)
+		if err := r.Create(ctx, current); err != nil {
+			return err
+		}
+		builds.Items = append(builds.Items, *current)
+	}
+
+	status := current.Status.DeepCopy()
+	if err := r.setBuildRecordStatus(ctx, o, job, current); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(status, &current.Status) {
+		if err := r.Status().Update(ctx, current); err != nil {
+			return err
+		}
+	}
+
+	o.Status.LatestBuild = current.Name
+	if current.Status.Result == v1alpha1.BuildSucceeded {
+		o.Status.LatestSuccessfulBuild = current.Name
+	}
+	return r.pruneBuilds(ctx, o, builds.Items)
+}
+
+// setBuildRecordStatus fills the build record from the Job, its pods and the OSImage phase
+func (r *OSImageReconciler) setBuildRecordStatus(ctx context.Context, o *v1alpha1.OSImage, job *batchv1.Job, build *v1alpha1.OSImageBuild) error {
+	status := &build.Status
+	status.JobRef = &v1.ObjectReference{
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Kind:       "Job",
+		Namespace:  job.Namespace,
+		Name:       job.Name,
+		UID:        job.UID,
+	}
+	status.StartTime = job.Status.StartTime
+
+	switch o.Status.Phase {
+	case v1alpha1.PhaseFailed:
+		status.Result = v1alpha1.BuildFailed
+		for i := range job.Status.Conditions {
+			if c := &job.Status.Conditions[i]; c.Type == batchv1.JobFailed && c.Status == v1.ConditionTrue {
+				status.FailureReason = fmt.Sprintf("%s: %s", c.Reason, c.Message)
+				status.CompletionTime = c.LastTransitionTime.DeepCopy()
+			}
+		}
+	case v1alpha1.PhaseSucceeded:
+		status.Result = v1alpha1.BuildSucceeded
+		status.CompletionTime = job.Status.CompletionTime
+		for _, t := range o.Status.OSTemplates {
+			if t.Moid == o.Status.BuiltTemplateMoid {
+				status.TemplateName, status.TemplateMoid = t.Name, t.Moid
+			}
+		}
+	default:
+		status.Result = v1alpha1.BuildRunning
+	}
+
+	var err error
+	if status.ImageBuilderDigest == "" {
+		if status.ImageBuilderDigest, err = r.getImageID(ctx, job.Namespace, map[string]string{"job-name": job.Name}); err != nil {
+			return err
+		}
+	}
+	if status.BundleDigest == "" {
+		if status.BundleDigest, err = r.getImageID(ctx, r.buildNamespace(o), map[string]string{LabelOSImageUID: string(o.UID)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getImageID returns the image ID of the first started container in the selected pods
+func (r *OSImageReconciler) getImageID(ctx context.Context, namespace string, selector map[string]string) (string, error) {
+	pods := &v1.PodList{}
+	if err := r.apiReader().List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(selector)); err != nil {
+		return "", err
+	}
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.ImageID != "" {
+				return cs.ImageID, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// pruneBuilds deletes the oldest build records over the OSImage history limit
+func (r *OSImageReconciler) pruneBuilds(ctx context.Context, o *v1alpha1.OSImage, builds []v1alpha1.OSImageBuild) error {
+	limit := DefaultBuildHistoryLimit
+	if o.Spec.BuildHistoryLimit != nil {
+		limit = int(*o.Spec.BuildHistoryLimit)
+	}
+
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].Spec.BuildNumber > builds[j].Spec.BuildNumber
+	})
+	for i := range builds {
+		if i < limit || builds[i].Name == o.Status.LatestSuccessfulBuild {
+			continue
+		}
+		log.FromContext(ctx).Info("Pruning build record.", "build", builds[i].Name)
+		if err := r.Delete(ctx, &builds[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
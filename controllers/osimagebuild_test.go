@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/windows"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("OSImage build records", func() {
+	var (
+		ctx        = context.Background()
+		reconciler *OSImageReconciler
+		o          *imagebuilderv1alpha1.OSImage
+		job        *batchv1.Job
+		release    *windows.KubernetesRelease
+		target     *windows.OSTarget
+	)
+
+	BeforeEach(func() {
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "osimagebuild-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		reconciler = &OSImageReconciler{Client: k8sClient, Scheme: scheme.Scheme}
+		o = newOSImage("windows")
+		o.Namespace = ns.Name
+		Expect(k8sClient.Create(ctx, o)).To(Succeed())
+		if o.UID == "" {
+			o.UID = "3c0fbd57-0a4e-4a4a-9a4f-1c1a2b3c4d5e"
+		}
+		o.Status.BuildNumber, o.Status.BuildHash = 1, "0123456789abcdef"
+
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "windows-ib-job", Namespace: ns.Name, UID: "job-uid"},
+			Spec: batchv1.JobSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				Containers: []v1.Container{{Name: "image-builder", Image: "image-builder:v0.1.12"}},
+			}}},
+		}
+
+		var err error
+		release, err = windows.GetKubernetesRelease("v1.23.8")
+		Expect(err).To(BeNil())
+		target, err = windows.GetOSTarget("2019", windows.EditionCore)
+		Expect(err).To(BeNil())
+	})
+
+	// listBuilds returns the build numbers of the OSImage records
+	listBuilds := func() map[int64]imagebuilderv1alpha1.OSImageBuildResult {
+		builds := &imagebuilderv1alpha1.OSImageBuildList{}
+		Expect(k8sClient.List(ctx, builds, client.InNamespace(o.Namespace))).To(Succeed())
+		results := map[int64]imagebuilderv1alpha1.OSImageBuildResult{}
+		for _, b := range builds.Items {
+			results[b.Spec.BuildNumber] = b.Status.Result
+		}
+		return results
+	}
+
+	// createBuild records a finished build of the OSImage
+	createBuild := func(number int64, result imagebuilderv1alpha1.OSImageBuildResult) *imagebuilderv1alpha1.OSImageBuild {
+		build := &imagebuilderv1alpha1.OSImageBuild{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      buildObjectName(o, fmt.Sprintf("build-%d", number)),
+				Namespace: o.Namespace,
+				Labels:    map[string]string{LabelOSImageUID: string(o.UID)},
+			},
+			Spec: imagebuilderv1alpha1.OSImageBuildSpec{OSImageName: o.Name, BuildNumber: number},
+		}
+		Expect(k8sClient.Create(ctx, build)).To(Succeed())
+		build.Status.Result = result
+		Expect(k8sClient.Status().Update(ctx, build)).To(Succeed())
+		return build
+	}
+
+	Describe("Setting the record status", func() {
+		var build *imagebuilderv1alpha1.OSImageBuild
+
+		BeforeEach(func() {
+			build = &imagebuilderv1alpha1.OSImageBuild{}
+		})
+
+		It("should record the running Job and the image digests", func() {
+			o.Status.Phase = imagebuilderv1alpha1.PhaseBuilding
+			started := metav1.Now()
+			job.Status.StartTime = &started
+			for _, pod := range []*v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "windows-ib-job-abcde", Labels: map[string]string{"job-name": job.Name}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "windows-resource-kit-abcde", Labels: map[string]string{LabelOSImageUID: string(o.UID)}}},
+			} {
+				pod.Namespace = o.Namespace
+				pod.Spec.Containers = []v1.Container{{Name: "main", Image: "image"}}
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				pod.Status.ContainerStatuses = []v1.ContainerStatus{{Name: "main", ImageID: "sha256:" + pod.Name}}
+				Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+			}
+
+			Expect(reconciler.setBuildRecordStatus(ctx, o, job, build)).To(Succeed())
+			Expect(build.Status.Result).To(Equal(imagebuilderv1alpha1.BuildRunning))
+			Expect(build.Status.JobRef.Name).To(Equal(job.Name))
+			Expect(build.Status.JobRef.UID).To(Equal(job.UID))
+			Expect(build.Status.StartTime).To(Equal(&started))
+			Expect(build.Status.CompletionTime).To(BeNil())
+			Expect(build.Status.ImageBuilderDigest).To(Equal("sha256:windows-ib-job-abcde"))
+			Expect(build.Status.BundleDigest).To(Equal("sha256:windows-resource-kit-abcde"))
+		})
+
+		It("should record the failure time and reason of the Job", func() {
+			o.Status.Phase = imagebuilderv1alpha1.PhaseFailed
+			failed := metav1.NewTime(time.Now().Add(-time.Hour))
+			job.Status.Conditions = []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: v1.ConditionTrue, Reason: "BackoffLimitExceeded",
+					Message: "Job has reached the specified backoff limit", LastTransitionTime: failed},
+				{Type: batchv1.JobSuspended, Status: v1.ConditionFalse, LastTransitionTime: metav1.Now()},
+			}
+
+			Expect(reconciler.setBuildRecordStatus(ctx, o, job, build)).To(Succeed())
+			Expect(build.Status.Result).To(Equal(imagebuilderv1alpha1.BuildFailed))
+			Expect(build.Status.FailureReason).To(Equal("BackoffLimitExceeded: Job has reached the specified backoff limit"))
+			Expect(build.Status.CompletionTime).To(Equal(&failed))
+		})
+
+		It("should record the published template", func() {
+			o.Status.Phase = imagebuilderv1alpha1.PhaseSucceeded
+			o.Status.BuiltTemplateMoid = "vm-42"
+			o.Status.OSTemplates = []imagebuilderv1alpha1.OSImageTemplates{
+				{Name: "windows-2019-kube-v1.23.8", Moid: "vm-41"},
+				{Name: "windows-2019-kube-v1.23.8", Moid: "vm-42"},
+			}
+			completed := metav1.Now()
+			job.Status.CompletionTime = &completed
+
+			Expect(reconciler.setBuildRecordStatus(ctx, o, job, build)).To(Succeed())
+			Expect(build.Status.Result).To(Equal(imagebuilderv1alpha1.BuildSucceeded))
+			Expect(build.Status.CompletionTime).To(Equal(&completed))
+			Expect(build.Status.TemplateName).To(Equal("windows-2019-kube-v1.23.8"))
+			Expect(build.Status.TemplateMoid).To(Equal("vm-42"))
+		})
+	})
+
+	Describe("Recording the builds", func() {
+		It("should create the record of the current build", func() {
+			o.Status.Phase = imagebuilderv1alpha1.PhaseBuilding
+			Expect(reconciler.recordBuild(ctx, o, job, release, target)).To(Succeed())
+
+			build := &imagebuilderv1alpha1.OSImageBuild{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: o.Namespace, Name: "windows-build-1"}, build)).To(Succeed())
+			Expect(build.Spec.BuildNumber).To(Equal(int64(1)))
+			Expect(build.Spec.InputHash).To(Equal("0123456789abcdef"))
+			Expect(build.Spec.ImageBuilderImage).To(Equal("image-builder:v0.1.12"))
+			Expect(build.Spec.BundleImage).To(Equal(release.BundleImage))
+			Expect(build.Spec.TemplateName).To(Equal("windows-2019-kube-v1.23.8"))
+			Expect(metav1.IsControlledBy(build, o)).To(BeTrue())
+			Expect(build.Status.Result).To(Equal(imagebuilderv1alpha1.BuildRunning))
+			Expect(o.Status.LatestBuild).To(Equal("windows-build-1"))
+			Expect(o.Status.LatestSuccessfulBuild).To(BeEmpty())
+
+			// The same build updates its record once the template is published.
+			o.Status.Phase = imagebuilderv1alpha1.PhaseSucceeded
+			Expect(reconciler.recordBuild(ctx, o, job, release, target)).To(Succeed())
+			Expect(listBuilds()).To(Equal(map[int64]imagebuilderv1alpha1.OSImageBuildResult{1: imagebuilderv1alpha1.BuildSucceeded}))
+			Expect(o.Status.LatestSuccessfulBuild).To(Equal("windows-build-1"))
+		})
+
+		It("should supersede the running records of older builds", func() {
+			createBuild(1, imagebuilderv1alpha1.BuildSucceeded)
+			createBuild(2, imagebuilderv1alpha1.BuildRunning)
+			o.Status.BuildNumber = 3
+			o.Status.Phase = imagebuilderv1alpha1.PhaseBuilding
+
+			Expect(reconciler.recordBuild(ctx, o, job, release, target)).To(Succeed())
+			Expect(listBuilds()).To(Equal(map[int64]imagebuilderv1alpha1.OSImageBuildResult{
+				1: imagebuilderv1alpha1.BuildSucceeded,
+				2: imagebuilderv1alpha1.BuildSuperseded,
+				3: imagebuilderv1alpha1.BuildRunning,
+			}))
+			Expect(o.Status.LatestBuild).To(Equal("windows-build-3"))
+		})
+	})
+
+	Describe("Pruning the history", func() {
+		var builds []imagebuilderv1alpha1.OSImageBuild
+
+		BeforeEach(func() {
+			builds = nil
+			for number := int64(1); number <= 5; number++ {
+				result := imagebuilderv1alpha1.BuildFailed
+				if number == 1 {
+					result = imagebuilderv1alpha1.BuildSucceeded
+				}
+				builds = append(builds, *createBuild(number, result))
+			}
+			o.Status.LatestSuccessfulBuild = builds[0].Name
+		})
+
+		It("should keep the newest builds and the latest successful one", func() {
+			limit := int32(2)
+			o.Spec.BuildHistoryLimit = &limit
+
+			Expect(reconciler.pruneBuilds(ctx, o, builds)).To(Succeed())
+			Expect(listBuilds()).To(Equal(map[int64]imagebuilderv1alpha1.OSImageBuildResult{
+				1: imagebuilderv1alpha1.BuildSucceeded,
+				4: imagebuilderv1alpha1.BuildFailed,
+				5: imagebuilderv1alpha1.BuildFailed,
+			}))
+		})
+
+		It("should keep the latest successful build without history", func() {
+			limit := int32(0)
+			o.Spec.BuildHistoryLimit = &limit
+
+			Expect(reconciler.pruneBuilds(ctx, o, builds)).To(Succeed())
+			Expect(listBuilds()).To(Equal(map[int64]imagebuilderv1alpha1.OSImageBuildResult{
+				1: imagebuilderv1alpha1.BuildSucceeded,
+			}))
+		})
+
+		It("should keep the default number of builds", func() {
+			builds = append(builds, *createBuild(6, imagebuilderv1alpha1.BuildSucceeded))
+			o.Status.LatestSuccessfulBuild = builds[5].Name
+
+			Expect(reconciler.pruneBuilds(ctx, o, builds)).To(Succeed())
+			Expect(listBuilds()).To(HaveLen(DefaultBuildHistoryLimit))
+			Expect(listBuilds()).NotTo(HaveKey(int64(1)))
+		})
+	})
+})
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	ReasonPlacementResolved    = "PlacementResolved"
+	ReasonPlacementNotResolved = "PlacementNotResolved"
+)
+
+// resolvePlacement sets status.placement from the spec, the omitted fields are resolved
+// once from the vSphere inventory and kept, so the build inputs do not change when the
+// inventory does. The mapper datacenter is set to the resolved one.
+func (r *OSImageReconciler) resolvePlacement(ctx context.Context, cmap *config.Mapper, o *v1alpha1.OSImage) error {
+	resolved := v1alpha1.OSImagePlacement{
+		Server:       cmap.Get(vsphere.VsphereServer),
+		Datacenter:   datacenterPath(o.Spec.VsphereDatacenter),
+		Folder:       o.Spec.VSphereFolder,
+		Datastore:    o.Spec.VSphereDataStore,
+		Network:      o.Spec.VSphereNetwork,
+		ResourcePool: o.Spec.VSphereResourcePool,
+		Cluster:      o.Spec.VSphereCluster,
+	}
+	if resolved.Datacenter == "" {
+		resolved.Datacenter = datacenterPath(cmap.Get(vsphere.VsphereDataCenter))
+	}
+	if resolved.Datacenter == "" {
+		return fmt.Errorf("no datacenter in the credentials, set spec.vsphereDatacenter")
+	}
+	cmap.Set(vsphere.VsphereDataCenter, resolved.Datacenter)
+
+	// Values resolved in another vCenter or datacenter are discarded, placements
+	// recorded before the vCenter was tracked are kept.
+	if previous := o.Status.Placement; previous != nil && previous.Datacenter == resolved.Datacenter &&
+		(previous.Server == "" || previous.Server == resolved.Server) {
+		resolved.Folder = firstNonEmpty(resolved.Folder, previous.Folder)
+		resolved.Datastore = firstNonEmpty(resolved.Datastore, previous.Datastore)
+		resolved.Network = firstNonEmpty(resolved.Network, previous.Network)
+		resolved.ResourcePool = firstNonEmpty(resolved.ResourcePool, previous.ResourcePool)
+		resolved.Cluster = firstNonEmpty(resolved.Cluster, previous.Cluster)
+	}
+
+	if resolved.Folder == "" || resolved.Datastore == "" || resolved.Network == "" ||
+		resolved.ResourcePool == "" || resolved.Cluster == "" {
+		if err := r.discoverPlacement(ctx, cmap, &resolved); err != nil {
+			return err
+		}
+	}
+	o.Status.Placement = &resolved
+	return nil
+}
+
+// discoverPlacement fills the empty placement fields from the vSphere inventory
+func (r *OSImageReconciler) discoverPlacement(ctx context.Context, cmap *config.Mapper, placement *v1alpha1.OSImagePlacement) error {
+	vc, dc, release, err := connect(ctx, r.VSphereClients, cmap)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// The management cluster nodes run in a compute cluster and network reachable from it.
+	var nodePlacement *vsphere.VirtualMachinePlacement
+	if placement.Cluster == "" || placement.Network == "" {
+		if nodePlacement, err = r.managementNodePlacement(ctx, vc, dc.Moid); err != nil {
+			return err
+		}
+	}
+
+	if placement.Cluster == "" {
+		if nodePlacement != nil && nodePlacement.Cluster != nil {
+			placement.Cluster = nodePlacement.Cluster.Path
+		} else {
+			clusters, err := vc.GetClusters(ctx, dc.Moid)
+			if err != nil {
+				return err
+			}
+			if len(clusters) == 0 {
+				return fmt.Errorf("no cluster found in datacenter %s", dc.Name)
+			}
+			placement.Cluster = clusters[0].Path
+		}
+	}
+
+	// Every cluster has a root resource pool.
+	if placement.ResourcePool == "" {
+		placement.ResourcePool = path.Join(placement.Cluster, "Resources")
+	}
+
+	if placement.Folder == "" {
+		placement.Folder = path.Join(dc.Name, "vm")
+	}
+
+	if placement.Network == "" {
+		if nodePlacement != nil && len(nodePlacement.Networks) > 0 {
+			placement.Network = nodePlacement.Networks[0].Path
+		} else {
+			networks, err := vc.GetNetworks(ctx, dc.Moid)
+			if err != nil {
+				return err
+			}
+			if len(networks) == 0 {
+				return fmt.Errorf("no network found in datacenter %s", dc.Name)
+			}
+			placement.Network = networks[0].Path
+		}
+	}
+
+	if placement.Datastore == "" {
+		if placement.Datastore, err = largestDatastore(ctx, vc, dc.Moid); err != nil {
+			return err
+		}
+		if placement.Datastore == "" {
+			return fmt.Errorf("no datastore found in datacenter %s", dc.Name)
+		}
+	}
+	return nil
+}
+
+// managementNodePlacement returns the placement of the first management cluster node
+// found in the datacenter, nodes are named after their virtual machines.
+func (r *OSImageReconciler) managementNodePlacement(ctx context.Context, vc vsphere.Client, datacenterMOID string) (*vsphere.VirtualMachinePlacement, error) {
+	nodes := &v1.NodeList{}
+	if err := r.apiReader().List(ctx, nodes); err != nil {
+		return nil, err
+	}
+	if len(nodes.Items) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names = append(names, node.Name)
+	}
+	return vc.GetVirtualMachinePlacement(ctx, datacenterMOID, names)
+}
+
+// largestDatastore returns the path of the datastore with the most free space
+func largestDatastore(ctx context.Context, vc vsphere.Client, datacenterMOID string) (string, error) {
+	datastores, err := vc.GetDatastores(ctx, datacenterMOID)
+	if err != nil {
+		return "", err
+	}
+	capacities, err := vc.GetDatastoreCapacities(ctx, datacenterMOID)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		largest   string
+		freeSpace int64 = -1
+	)
+	for _, ds := range datastores {
+		if free := capacities[ds.Moid].FreeSpace; free > freeSpace {
+			largest, freeSpace = ds.Path, free
+		}
+	}
+	return largest, nil
+}
+
+// datacenterPath returns the datacenter inventory path, names are rooted
+func datacenterPath(datacenter string) string {
+	if datacenter == "" || strings.HasPrefix(datacenter, "/") {
+		return datacenter
+	}
+	return "/" + datacenter
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"github.com/knabben/tkw/pkg/windows"
+)
+
+const (
+	ReasonPreflightFailed = "PreflightFailed"
+	ReasonPreflightPassed = "PreflightPassed"
+)
+
+// errPreflightFailed is returned while the preflight checks fail, so the checks are
+// retried with the backoff of the workqueue.
+var errPreflightFailed = errors.New("the vSphere preflight checks failed")
+
+// connect returns the client of the mapper credentials, the configured datacenter
+// and the release function of the client.
+func connect(ctx context.Context, clients vsphere.ClientFactory, cmap *config.Mapper) (vsphere.Client, *models.VSphereDatacenter, func(), error) {
+	vc, release, err := login(ctx, clients, cmap)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dc, err := vsphere.FilterDatacenter(ctx, vc, cmap.Get(vsphere.VsphereDataCenter))
+	if err == nil && dc == nil {
+		err = fmt.Errorf("datacenter %s not found", cmap.Get(vsphere.VsphereDataCenter))
+	}
+	if err != nil {
+		release()
+		return nil, nil, nil, err
+	}
+	return vc, dc, release, nil
+}
+
+// login returns the client of the mapper credentials and its release function
+func login(ctx context.Context, clients vsphere.ClientFactory, cmap *config.Mapper) (vsphere.Client, func(), error) {
+	if clients == nil {
+		return nil, nil, fmt.Errorf("no vCenter client factory configured")
+	}
+	return clients.Get(ctx,
+		cmap.Get(vsphere.VsphereServer),
+		cmap.Get(vsphere.VsphereUsername),
+		cmap.Get(vsphere.VspherePassword),
+		tlsConfig(cmap),
+	)
+}
+
+// sessionTimeouts returns the timeouts of the vCenter calls made with the session
+// cache, the other factories use the default ones.
+func sessionTimeouts(clients vsphere.ClientFactory) vsphere.Timeouts {
+	if sessions, ok := clients.(*vsphere.Sessions); ok && sessions != nil {
+		return sessions.Timeouts
+	}
+	return vsphere.DefaultTimeouts
+}
+
+// tlsConfig returns the trust settings of the vCenter loaded with the credentials
+func tlsConfig(cmap *config.Mapper) vsphere.TLSConfig {
+	return vsphere.TLSConfig{
+		Thumbprint: cmap.Get(vsphere.VsphereThumbprint),
+		CABundle:   []byte(cmap.Get(vsphere.VsphereCABundle)),
+		Insecure:   cmap.Get(vsphere.VsphereInsecure) == "true",
+	}
+}
+
+// preflight checks the inventory objects and ISOs referenced by the spec exist in
+// the datacenter, it returns a message for each failed check.
+func (r *OSImageReconciler) preflight(ctx context.Context, cmap *config.Mapper, o *v1alpha1.OSImage) ([]string, error) {
+	vc, dc, release, err := connect(ctx, r.VSphereClients, cmap)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	placement := o.Status.Placement
+	var (
+		failures       []string
+		datastoreFound = true
+	)
+	if failure := packerTrustFailure(ctx, cmap); failure != "" {
+		failures = append(failures, failure)
+	}
+	objects := []struct {
+		field, resourceType, name string
+		list                      func(context.Context, string) ([]*models.VSphereManagementObject, error)
+	}{
+		{"vsphereDatastore", models.VSphereManagementObjectResourceTypeDatastore, placement.Datastore, vc.GetDatastores},
+		{"vsphereNetwork", models.VSphereManagementObjectResourceTypeNetwork, placement.Network, vc.GetNetworks},
+		{"vsphereFolder", models.VSphereManagementObjectResourceTypeFolder, placement.Folder, vc.GetFolders},
+		{"vsphereResourcePool", models.VSphereManagementObjectResourceTypeRespool, placement.ResourcePool, vc.GetResourcePools},
+		{"vsphereCluster", models.VSphereManagementObjectResourceTypeCluster, placement.Cluster, vc.GetClusters},
+	}
+	for _, obj := range objects {
+		if _, err := vc.FindObject(ctx, dc.Moid, obj.resourceType, obj.name); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %q not found in datacenter %s: %s%s",
+				obj.field, obj.name, dc.Name, err.Error(), availableChoices(ctx, dc.Moid, obj.list)))
+			if obj.resourceType == models.VSphereManagementObjectResourceTypeDatastore {
+				datastoreFound = false
+			}
+		}
+	}
+
+	isos := []struct {
+		field, path string
+	}{
+		{"windowsISOPath", o.Spec.WindowsISOPath},
+		{"vmtoolsPath", o.Spec.VMToolsPath},
+	}
+	for _, iso := range isos {
+		datastore, file := windows.ISOLocation(iso.path, placement.Datastore)
+		if datastore == placement.Datastore {
+			// The ISOs on the build datastore can not be searched without it.
+			if !datastoreFound {
+				continue
+			}
+		} else if _, err := vc.FindObject(ctx, dc.Moid, models.VSphereManagementObjectResourceTypeDatastore, datastore); err != nil {
+			failures = append(failures, fmt.Sprintf("%s datastore %q not found in datacenter %s: %s", iso.field, datastore, dc.Name, err.Error()))
+			continue
+		}
+		found, err := vc.DatastoreFileExists(ctx, dc.Moid, datastore, file)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("%s file %s not found in datastore %s", iso.field, file, datastore))
+		}
+	}
+	return failures, nil
+}
+
+// packerTrustFailure checks Packer can verify the vCenter certificate pinned with the
+// thumbprint. The controller only matches the thumbprint, while Packer trusts the
+// certificate as a CA bundle and verifies the host name too.
+func packerTrustFailure(ctx context.Context, cmap *config.Mapper) string {
+	trust := tlsConfig(cmap)
+	if trust.Insecure || len(trust.CABundle) > 0 || trust.Thumbprint == "" {
+		return ""
+	}
+	server := cmap.Get(vsphere.VsphereServer)
+	if err := vsphere.VerifyPinnedHostname(ctx, server, trust.Thumbprint); err != nil {
+		return fmt.Sprintf("the vCenter %s certificate can not be verified by Packer: %s, "+
+			"use a server name of the certificate or a CA bundle", server, err.Error())
+	}
+	return ""
+}
+
+// availableChoices lists the paths of the existing objects to help fixing the spec,
+// the listing is best effort and returns nothing on errors.
+func availableChoices(ctx context.Context, datacenterMOID string, list func(context.Context, string) ([]*models.VSphereManagementObject, error)) string {
+	objects, err := list(ctx, datacenterMOID)
+	if err != nil || len(objects) == 0 {
+		return ""
+	}
+	paths := make([]string, len(objects))
+	for i, obj := range objects {
+		paths[i] = obj.Path
+	}
+	return fmt.Sprintf(", available: %s", strings.Join(paths, ", "))
+}
@@ -7,43 +7,127 @@ import (
 	"github.com/knabben/tkw/controllers/assets"
 	"github.com/knabben/tkw/pkg/config"
 	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/windows"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"regexp"
-	ctrl "sigs.k8s.io/controller-runtime"
+	"os"
+	"path"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"strconv"
+	"strings"
 )
 
-// getCredentials fetch the vsphere-cloud-config cm and extract data in the mapper
-func (r *OSImageReconciler) getCredentials(ctx context.Context, cmap *config.Mapper) error {
+// getCloudConfigCredentials fetch the vsphere-cloud-config cm and extract data in the mapper,
+// the cloud provider Secret is read with the secrets reader. The server selects the
+// vCenter of vsphere.conf, the first one is used when it is empty. The returned warning
+// reports the settings ignored while loading the credentials.
+func getCloudConfigCredentials(ctx context.Context, reader, secrets client.Reader, server string, cmap *config.Mapper) (string, error) {
 	vsphereCM, name := &v1.ConfigMap{}, "vsphere-cloud-config"
-	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: TKG_NAMESPACE}, vsphereCM); err != nil {
-		return err
+	if err := reader.Get(ctx, types.NamespacedName{Name: name, Namespace: TKG_NAMESPACE}, vsphereCM); err != nil {
+		return "", err
 	}
 
-	// Fetch vsphere-cloud-config and extract data
+	cloudConfig, err := config.ParseCloudConfig(vsphereCM.Data["vsphere.conf"])
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to parse vsphere.conf: %v", name, err)
+	}
+	vc, err := cloudConfig.VirtualCenter(server)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", name, err)
+	}
+	cmap.Set(vsphere.VsphereServer, vc.Address())
+	cmap.Set(vsphere.VsphereDataCenter, vc.Datacenter())
+	cmap.Set(vsphere.VsphereThumbprint, vc.Thumbprint)
+	cmap.Set(vsphere.VsphereInsecure, strconv.FormatBool(vc.InsecureFlag))
+
+	// The ca-file is a path of the cloud provider nodes, it is only read when it is also
+	// mounted in the controller. Otherwise the certificate is verified with the
+	// thumbprint or the system roots.
+	var warning string
+	if vc.CAFile != "" && !vc.InsecureFlag {
+		caBundle, err := os.ReadFile(vc.CAFile)
+		if os.IsNotExist(err) {
+			warning = fmt.Sprintf("the vCenter %s ca-file %s is not mounted in the controller, the certificate is verified with %s",
+				vc.Server, vc.CAFile, fallbackTrust(vc.Thumbprint))
+			log.FromContext(ctx).Info("Ignoring the vsphere.conf ca-file.", "server", vc.Server, "ca-file", vc.CAFile)
+		} else if err != nil {
+			return "", fmt.Errorf("%s: unable to read the vCenter %s ca-file: %v", name, vc.Server, err)
+		} else {
+			cmap.Set(vsphere.VsphereCABundle, string(caBundle))
+		}
+	}
+
+	// Credentials are set inline when vsphere.conf references no Secret.
+	if vc.SecretName == "" {
+		if vc.User == "" || vc.Password == "" {
+			return warning, fmt.Errorf("%s: vCenter %s has no credentials", name, vc.Server)
+		}
+		cmap.Set(vsphere.VsphereUsername, vc.User)
+		cmap.Set(vsphere.VspherePassword, vc.Password)
+		return warning, nil
+	}
+
+	// Fetch the cloud provider Secret, its keys are prefixed with the vCenter server.
 	var vsphereSM = &v1.Secret{}
-	data := vsphereCM.Data["vsphere.conf"]
-	cmap.Set(vsphere.VsphereServer, extractRValue(`\[VirtualCenter "(.*)"\]`, data))
-	namespacedName := types.NamespacedName{
-		Name:      extractRValue(`secret-name = "(.*)"`, data),
-		Namespace: extractRValue(`secret-namespace = "(.*)"`, data),
+	namespacedName := types.NamespacedName{Name: vc.SecretName, Namespace: vc.SecretNamespace}
+	if namespacedName.Namespace == "" {
+		namespacedName.Namespace = TKG_NAMESPACE
+	}
+	if err := secrets.Get(ctx, namespacedName, vsphereSM); err != nil {
+		return warning, err
+	}
+	username := vsphereSM.Data[fmt.Sprintf("%s.%s", vc.Server, "username")]
+	password := vsphereSM.Data[fmt.Sprintf("%s.%s", vc.Server, "password")]
+	if len(username) == 0 || len(password) == 0 {
+		return warning, fmt.Errorf("secret %s has no credentials for vCenter %s", namespacedName, vc.Server)
 	}
+	cmap.Set(vsphere.VsphereUsername, string(username))
+	cmap.Set(vsphere.VspherePassword, string(password))
+	return warning, nil
+}
 
-	// Set DataCenter from configMap
-	cmap.Set(vsphere.VsphereDataCenter, extractRValue(`datacenters = "(.*)"`, data))
+// fallbackTrust describes the certificate verification without CA bundle
+func fallbackTrust(thumbprint string) string {
+	if thumbprint != "" {
+		return "the thumbprint"
+	}
+	return "the system roots"
+}
 
-	if err := r.Get(ctx, namespacedName, vsphereSM); err != nil {
-		return err
+// getPackerVariables returns the user packer variables, the referenced ConfigMap
+// data comes first so the spec inline variables take precedence.
+func (r *OSImageReconciler) getPackerVariables(ctx context.Context, ib *v1alpha1.OSImage) ([]map[string]string, error) {
+	var overrides []map[string]string
+	if ref := ib.Spec.PackerVariablesRef; ref != nil {
+		variablesCM := &v1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ib.Namespace}, variablesCM); err != nil {
+			return nil, fmt.Errorf("unable to get packer variables configmap: %v", err)
+		}
+		overrides = append(overrides, variablesCM.Data)
 	}
-	vcIP := cmap.Get(vsphere.VsphereServer)
-	cmap.Set(vsphere.VsphereUsername, string(vsphereSM.Data[fmt.Sprintf("%s.%s", vcIP, "username")]))
-	cmap.Set(vsphere.VspherePassword, string(vsphereSM.Data[fmt.Sprintf("%s.%s", vcIP, "password")]))
-	return nil
+	return append(overrides, ib.Spec.PackerVariables), nil
+}
+
+// requestsForPackerVariables maps a ConfigMap event to the OSImages referencing it
+// in packerVariablesRef
+func (r *OSImageReconciler) requestsForPackerVariables(object client.Object) []reconcile.Request {
+	images := &v1alpha1.OSImageList{}
+	if err := r.List(context.Background(), images, client.InNamespace(object.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, o := range images.Items {
+		if ref := o.Spec.PackerVariablesRef; ref != nil && ref.Name == object.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: o.Namespace, Name: o.Name}})
+		}
+	}
+	return requests
 }
 
 func (r *OSImageReconciler) getOrCreate(ctx context.Context, object client.Object) (client.Object, error) {
@@ -69,13 +153,15 @@ type WindowsResourceBundle struct {
 }
 
 // getOrCreateWindowsResourceBundle returns the Windows resource bundle specification
-func (r *OSImageReconciler) getOrCreateWindowsResourceBundle(ctx context.Context, ib *v1alpha1.OSImage) (*WindowsResourceBundle, error) {
+func (r *OSImageReconciler) getOrCreateWindowsResourceBundle(ctx context.Context, release *windows.KubernetesRelease, ib *v1alpha1.OSImage) (*WindowsResourceBundle, error) {
 	// Check for Windows resource bundle deployment and create
 	deploy := assets.YAMLAccessor[*appsv1.Deployment]{}
 	depObject, err := deploy.GetDecodedObject(assets.BUILDER_DEPLOYMENT, appsv1.SchemeGroupVersion)
 	if err != nil {
 		return nil, err
 	}
+	// The bundle image tag follows the Kubernetes version being built.
+	depObject.Spec.Template.Spec.Containers[0].Image = release.BundleImage
 
 	// Check for the Windows resource bundle service and create
 	svc := assets.YAMLAccessor[*v1.Service]{}
@@ -84,9 +170,15 @@ func (r *OSImageReconciler) getOrCreateWindowsResourceBundle(ctx context.Context
 		return nil, err
 	}
 
-	// Set controller reference and create the object
-	for _, x := range []client.Object{depObject, svcObject} {
-		if err := ctrl.SetControllerReference(ib, x, r.Scheme); err != nil {
+	// Each OSImage has its own bundle, the service only selects its pods.
+	depObject.Spec.Selector.MatchLabels[LabelOSImageUID] = string(ib.UID)
+	depObject.Spec.Template.Labels[LabelOSImageUID] = string(ib.UID)
+	svcObject.Spec.Selector[LabelOSImageUID] = string(ib.UID)
+	svcObject.Spec.Type = bundleServiceType(ib)
+
+	// Set the build metadata and create the object
+	for suffix, x := range map[string]client.Object{suffixResourceKit: depObject, suffixResource: svcObject} {
+		if err := r.setBuildObjectMeta(ib, x, suffix); err != nil {
 			return nil, err
 		}
 		if _, err := r.getOrCreate(ctx, x); err != nil {
@@ -94,53 +186,180 @@ func (r *OSImageReconciler) getOrCreateWindowsResourceBundle(ctx context.Context
 		}
 	}
 
+	// Roll the bundle when the Kubernetes version changes on the spec.
+	if container := &depObject.Spec.Template.Spec.Containers[0]; container.Image != release.BundleImage {
+		log.FromContext(ctx).Info("Updating resource bundle image.", "image", release.BundleImage)
+		container.Image = release.BundleImage
+		if err := r.Update(ctx, depObject); err != nil {
+			return nil, err
+		}
+	}
+
+	// Expose the bundle following the address strategy.
+	if serviceType := bundleServiceType(ib); svcObject.Spec.Type != serviceType {
+		log.FromContext(ctx).Info("Updating resource bundle service type.", "type", serviceType)
+		svcObject.Spec.Type = serviceType
+		if serviceType == v1.ServiceTypeClusterIP {
+			for i := range svcObject.Spec.Ports {
+				svcObject.Spec.Ports[i].NodePort = 0
+			}
+		}
+		if err := r.Update(ctx, svcObject); err != nil {
+			return nil, err
+		}
+	}
+
 	return &WindowsResourceBundle{
 		Deployment: depObject,
 		Service:    svcObject,
 	}, nil
 }
 
-func (r *OSImageReconciler) getOrCreateWindowsImageBuilder(ctx context.Context, config string, ib *v1alpha1.OSImage) error {
-	// Check for Windows resource bundle deployment and create
-	configmap := assets.YAMLAccessor[*v1.ConfigMap]{}
-	cmObject, err := configmap.GetDecodedObject(assets.IB_CONFIG, v1.SchemeGroupVersion)
-	if err != nil {
-		return err
-	}
+// getOrCreateWindowsImageBuilder creates the Secret holding windows.json and the
+// Job running image-builder, the Secret carries the vCenter credentials so it
+// only lives while the build is running. A Job built from other inputs is
+// superseded by a new build.
+func (r *OSImageReconciler) getOrCreateWindowsImageBuilder(ctx context.Context, cmap *config.Mapper, config, hashConfig string, target *windows.OSTarget, ib *v1alpha1.OSImage) (*batchv1.Job, error) {
+	logger := log.FromContext(ctx)
 
-	// Save json data in the object and create the configmap.
-	cmObject.Data = map[string]string{"windows.json": config}
-	if _, err := r.getOrCreate(ctx, cmObject); err != nil {
-		return err
+	secret := assets.YAMLAccessor[*v1.Secret]{}
+	secretObject, err := secret.GetDecodedObject(assets.IB_SECRET, v1.SchemeGroupVersion)
+	if err != nil {
+		return nil, err
 	}
 
 	// Creates the Job from spec file.
 	job := assets.YAMLAccessor[*batchv1.Job]{}
 	jobObject, err := job.GetDecodedObject(assets.IB_JOB, batchv1.SchemeGroupVersion)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	jobObject.Spec.Template.Spec.Containers[0].Args = []string{target.MakeTarget}
+
+	if err := r.setBuildObjectMeta(ib, secretObject, suffixSecret); err != nil {
+		return nil, err
+	}
+	if err := r.setBuildObjectMeta(ib, jobObject, suffixJob); err != nil {
+		return nil, err
+	}
+	jobObject.Spec.Template.Spec.Volumes[0].Secret.SecretName = secretObject.Name
+
+	hash, err := buildHash(hashConfig, jobObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Job is read from the API server, a cached Job deleted on the last hash
+	// change would be compared or created again.
+	existingJob := &batchv1.Job{}
+	if err := r.apiReader().Get(ctx, client.ObjectKeyFromObject(jobObject), existingJob); err == nil {
+		buildNumber := getBuildNumber(existingJob)
+		if existingJob.Annotations[AnnotationBuildHash] == hash {
+			ib.Status.BuildHash, ib.Status.BuildNumber = hash, buildNumber
+			// Remove the credentials once the build is finished.
+			if isJobFinished(existingJob) {
+				logger.Info("Build finished, deleting the configuration secret.", "secret", client.ObjectKeyFromObject(secretObject))
+				return existingJob, client.IgnoreNotFound(r.Delete(ctx, secretObject))
+			}
+			return existingJob, nil
+		}
+	} else if !errors.IsNotFound(err) {
+		return nil, err
 	}
-	if err := ctrl.SetControllerReference(ib, jobObject, r.Scheme); err != nil {
-		return err
+
+	// Validate the vSphere inventory before a new build is started, the Job is
+	// not created while any check fails.
+	failures, err := r.preflight(ctx, cmap, ib)
+	if err != nil {
+		return nil, err
 	}
-	if _, err := r.getOrCreate(ctx, jobObject); err != nil {
-		return err
+	if len(failures) > 0 {
+		setCondition(ib, v1alpha1.ConditionPreflightFailed, metav1.ConditionTrue, ReasonPreflightFailed, strings.Join(failures, "; "))
+		return nil, errPreflightFailed
 	}
+	setCondition(ib, v1alpha1.ConditionPreflightFailed, metav1.ConditionFalse, ReasonPreflightPassed,
+		"vSphere inventory and ISOs found.")
 
-	return nil
+	if existingJob.Name != "" {
+		buildNumber := getBuildNumber(existingJob)
+		// The build inputs changed, supersede the old build.
+		logger.Info("Build inputs changed, deleting the old build.", "job", client.ObjectKeyFromObject(existingJob), "build", buildNumber)
+		if err := r.Delete(ctx, existingJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err := r.Delete(ctx, secretObject); client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if buildNumber > ib.Status.BuildNumber {
+			ib.Status.BuildNumber = buildNumber
+		}
+	}
+
+	// Save json data in the object and create the secret.
+	buildNumber := ib.Status.BuildNumber + 1
+	secretObject.Data = map[string][]byte{"windows.json": []byte(config)}
+
+	// Packer verifies the vCenter certificate with the same trust settings.
+	pinCtx, cancel := sessionTimeouts(r.VSphereClients).APIContext(ctx)
+	defer cancel()
+	caBundle, err := packerCABundle(pinCtx, cmap)
+	if err != nil {
+		return nil, err
+	}
+	if len(caBundle) > 0 {
+		secretObject.Data[packerCABundleKey] = caBundle
+		setPackerCABundle(jobObject)
+	}
+	for _, x := range []client.Object{secretObject, jobObject} {
+		x.SetAnnotations(setBuildAnnotations(x.GetAnnotations(), hash, buildNumber))
+		if err := r.Create(ctx, x); err != nil {
+			return nil, err
+		}
+	}
+	logger.Info("Build started.", "job", client.ObjectKeyFromObject(jobObject), "build", buildNumber)
+	ib.Status.BuildHash, ib.Status.BuildNumber = hash, buildNumber
+
+	return jobObject, nil
 }
 
-func extractRValue(v, d string) string {
-	var (
-		re  *regexp.Regexp
-		err error
-	)
-	if re, err = regexp.Compile(v); err != nil {
-		return ""
+// packerCABundleKey is the build Secret key of the CA bundle trusted by Packer
+const packerCABundleKey = "ca.crt"
+
+// packerCABundle returns the CA bundle trusted by Packer, the certificate matching
+// the thumbprint is pinned since Packer has no thumbprint verification.
+func packerCABundle(ctx context.Context, cmap *config.Mapper) ([]byte, error) {
+	trust := tlsConfig(cmap)
+	switch {
+	case trust.Insecure:
+		return nil, nil
+	case len(trust.CABundle) > 0:
+		return trust.CABundle, nil
+	case trust.Thumbprint != "":
+		return vsphere.PinnedCertificate(ctx, cmap.Get(vsphere.VsphereServer), trust.Thumbprint)
 	}
-	submatch := re.FindStringSubmatch(d)
-	if len(submatch) < 1 {
-		return ""
+	return nil, nil
+}
+
+// setPackerCABundle mounts the CA bundle of the build Secret next to the packer
+// variables, SSL_CERT_FILE replaces the default CA file read by Packer with it.
+func setPackerCABundle(job *batchv1.Job) {
+	podSpec := &job.Spec.Template.Spec
+	volume := podSpec.Volumes[0].Secret
+	volume.Items = append(volume.Items, v1.KeyToPath{Key: packerCABundleKey, Path: packerCABundleKey})
+
+	container := &podSpec.Containers[0]
+	container.Env = append(container.Env, v1.EnvVar{
+		Name:  "SSL_CERT_FILE",
+		Value: path.Join(container.VolumeMounts[0].MountPath, packerCABundleKey),
+	})
+}
+
+// isJobFinished returns true when the Job completed or failed
+func isJobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == v1.ConditionTrue {
+			return true
+		}
 	}
-	return submatch[1]
+	return false
 }
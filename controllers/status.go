@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/vmware/govmomi/vim25/mo"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ReasonCredentialsNotFound  = "CredentialsNotFound"
+	ReasonCredentialsForbidden = "CredentialsForbidden"
+	ReasonCredentialsResolved  = "CredentialsResolved"
+	ReasonCAFileNotMounted     = "CAFileNotMounted"
+	ReasonDeploymentAvailable  = "DeploymentAvailable"
+	ReasonAddressNotAssigned   = "AddressNotAssigned"
+	ReasonJobPending           = "JobPending"
+	ReasonJobRunning           = "JobRunning"
+	ReasonJobSucceeded         = "JobSucceeded"
+	ReasonJobFailed            = "JobFailed"
+	ReasonTemplateFound        = "TemplateFound"
+	ReasonTemplateNotFound     = "TemplateNotFound"
+)
+
+// setCondition sets a condition observed on the current OSImage generation
+func setCondition(o *v1alpha1.OSImage, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&o.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: o.Generation,
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	})
+}
+
+// updateStatus saves the status flagging the spec generation as observed
+func (r *OSImageReconciler) updateStatus(ctx context.Context, o *v1alpha1.OSImage) error {
+	o.Status.ObservedGeneration = o.Generation
+	if len(o.Status.Targets) > 0 {
+		o.Status.Targets[0] = targetStatus(o)
+		setTargetsCondition(o)
+	}
+	return r.Status().Update(ctx, o)
+}
+
+// isDeploymentAvailable returns true when the Deployment rolled out the current
+// template and has available replicas
+func isDeploymentAvailable(deployment *appsv1.Deployment) bool {
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == status.Replicas &&
+		status.AvailableReplicas > 0
+}
+
+// setJobStatus sets the BuildJobRunning condition and the phase from the Job state
+func setJobStatus(o *v1alpha1.OSImage, job *batchv1.Job) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobFailed:
+			o.Status.Phase = v1alpha1.PhaseFailed
+			setCondition(o, v1alpha1.ConditionBuildJobRunning, metav1.ConditionFalse, ReasonJobFailed,
+				fmt.Sprintf("job %s failed: %s", job.Name, c.Message))
+			return
+		case batchv1.JobComplete:
+			// The template of a succeeded build is tracked by the resync.
+			if o.Status.Phase != v1alpha1.PhaseSucceeded {
+				o.Status.Phase = v1alpha1.PhasePublishing
+			}
+			setCondition(o, v1alpha1.ConditionBuildJobRunning, metav1.ConditionFalse, ReasonJobSucceeded,
+				fmt.Sprintf("job %s succeeded.", job.Name))
+			setCondition(o, v1alpha1.ConditionBuildFailed, metav1.ConditionFalse, ReasonJobSucceeded,
+				fmt.Sprintf("job %s succeeded.", job.Name))
+			return
+		}
+	}
+	setCondition(o, v1alpha1.ConditionBuildFailed, metav1.ConditionFalse, ReasonJobRunning,
+		fmt.Sprintf("job %s has not failed.", job.Name))
+
+	o.Status.Phase = v1alpha1.PhaseBuilding
+	if job.Status.Active > 0 {
+		setCondition(o, v1alpha1.ConditionBuildJobRunning, metav1.ConditionTrue, ReasonJobRunning,
+			fmt.Sprintf("job %s is running.", job.Name))
+		return
+	}
+	setCondition(o, v1alpha1.ConditionBuildJobRunning, metav1.ConditionFalse, ReasonJobPending,
+		fmt.Sprintf("job %s is waiting for pods.", job.Name))
+}
+
+// setTemplateStatus sets the TemplateAvailable condition, a published build succeeds
+// once the template it built, identified by builtMoid, shows up in vSphere.
+func setTemplateStatus(o *v1alpha1.OSImage, templateName, builtMoid string) {
+	if o.Status.Phase == v1alpha1.PhasePublishing {
+		if builtMoid == "" {
+			setCondition(o, v1alpha1.ConditionTemplateAvailable, metav1.ConditionFalse, ReasonTemplateNotFound,
+				fmt.Sprintf("template %s built by the job not found in vSphere.", templateName))
+			return
+		}
+		o.Status.Phase = v1alpha1.PhaseSucceeded
+		o.Status.BuiltTemplateMoid = builtMoid
+	}
+	for _, t := range o.Status.OSTemplates {
+		if t.Name == templateName {
+			setCondition(o, v1alpha1.ConditionTemplateAvailable, metav1.ConditionTrue, ReasonTemplateFound,
+				fmt.Sprintf("template %s is available.", templateName))
+			return
+		}
+	}
+	setCondition(o, v1alpha1.ConditionTemplateAvailable, metav1.ConditionFalse, ReasonTemplateNotFound,
+		fmt.Sprintf("template %s not found in vSphere.", templateName))
+}
+
+// builtTemplate returns the managed object ID of the template named templateName
+// created by the Job, templates created before the Job started are left by previous
+// builds. A template without creation date is trusted by its name.
+func builtTemplate(vms []mo.VirtualMachine, templateName string, job *batchv1.Job) string {
+	for _, vm := range vms {
+		if vm.Name != templateName {
+			continue
+		}
+		if vm.Config == nil || vm.Config.CreateDate == nil || job.Status.StartTime == nil {
+			return vm.Self.Value
+		}
+		// The Job start time is truncated to the second.
+		if !vm.Config.CreateDate.Before(job.Status.StartTime.Time.Truncate(time.Second)) {
+			return vm.Self.Value
+		}
+	}
+	return ""
+}
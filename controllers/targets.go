@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// LabelParentOSImageUID selects the OSImages building the additional targets of an OSImage
+	LabelParentOSImageUID = "imagebuilder.tanzu.opssec.in/parent-osimage-uid"
+
+	ReasonTargetsReady    = "TargetsReady"
+	ReasonTargetsNotReady = "TargetsNotReady"
+)
+
+// targetOSImageName names the OSImage of an additional target after its vCenter
+// and datacenter, so reordering the targets does not rebuild them.
+func targetOSImageName(o *v1alpha1.OSImage, target v1alpha1.VSphereTarget) string {
+	sum := sha256.Sum256([]byte(target.Server + datacenterPath(target.Datacenter)))
+	return buildObjectName(o, fmt.Sprintf("vc-%x", sum[:4]))
+}
+
+// targetOSImage returns the OSImage building an additional target, it copies the
+// build inputs of the parent with the target vCenter and placement.
+func targetOSImage(o *v1alpha1.OSImage, target v1alpha1.VSphereTarget) *v1alpha1.OSImage {
+	spec := o.Spec.DeepCopy()
+	spec.VSphereServer = target.Server
+	spec.VsphereDatacenter = target.Datacenter
+	spec.VSphereFolder = target.Folder
+	spec.VSphereDataStore = target.Datastore
+	spec.VSphereNetwork = target.Network
+	spec.VSphereResourcePool = target.ResourcePool
+	spec.VSphereCluster = target.Cluster
+	if target.CredentialsRef != nil {
+		spec.CredentialsRef = target.CredentialsRef.DeepCopy()
+	}
+	spec.AdditionalTargets = nil
+
+	return &v1alpha1.OSImage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      targetOSImageName(o, target),
+			Namespace: o.Namespace,
+			Labels:    map[string]string{LabelParentOSImageUID: string(o.UID)},
+		},
+		Spec: *spec,
+	}
+}
+
+// reconcileTargets creates an OSImage per additional target, keeps their spec in sync
+// with the parent, deletes the removed ones and reports their state in status.targets.
+func (r *OSImageReconciler) reconcileTargets(ctx context.Context, o *v1alpha1.OSImage) error {
+	children := &v1alpha1.OSImageList{}
+	if err := r.List(ctx, children, client.InNamespace(o.Namespace),
+		client.MatchingLabels{LabelParentOSImageUID: string(o.UID)}); err != nil {
+		return err
+	}
+
+	logger := log.FromContext(ctx)
+	statuses := []v1alpha1.OSImageTargetStatus{targetStatus(o)}
+	parentKeys := targetKeys(o)
+	desired := map[string]bool{}
+	for _, target := range o.Spec.AdditionalTargets {
+		// The defaulted parent vCenter datacenter is only known once resolved.
+		if parentKeys[target.Server+datacenterPath(target.Datacenter)] {
+			logger.Info("Skipping the additional target of the OSImage vCenter datacenter.",
+				"server", target.Server, "datacenter", target.Datacenter)
+			continue
+		}
+		child := targetOSImage(o, target)
+		desired[child.Name] = true
+		if err := r.applyTargetOSImage(ctx, o, child); err != nil {
+			return fmt.Errorf("unable to apply the OSImage of vCenter %s: %v", target.Server, err)
+		}
+		statuses = append(statuses, targetStatus(child))
+	}
+
+	for i := range children.Items {
+		if desired[children.Items[i].Name] {
+			continue
+		}
+		if err := r.Delete(ctx, &children.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+
+	o.Status.Targets = statuses
+	setTargetsCondition(o)
+	return nil
+}
+
+// applyTargetOSImage creates the target OSImage or updates its spec, the child is
+// refreshed with the stored object so its status can be reported. The spec of a
+// building target is immutable, it is updated by the reconcile following its build.
+func (r *OSImageReconciler) applyTargetOSImage(ctx context.Context, o, child *v1alpha1.OSImage) error {
+	existing := &v1alpha1.OSImage{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: child.Namespace, Name: child.Name}, existing)
+	if errors.IsNotFound(err) {
+		if err := ctrl.SetControllerReference(o, child, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(ctx, child)
+	} else if err != nil {
+		return err
+	}
+
+	if !equality.Semantic.DeepEqual(existing.Spec, child.Spec) {
+		if isBuildRunning(existing) {
+			log.FromContext(ctx).Info("Target OSImage is building, updating it after its build.",
+				"osimage", child.Name, "phase", existing.Status.Phase)
+		} else {
+			updated := existing.DeepCopy()
+			updated.Spec = child.Spec
+			if err := r.Update(ctx, updated); err != nil {
+				return err
+			}
+			existing = updated
+		}
+	}
+	*child = *existing
+	return nil
+}
+
+// isBuildRunning returns true while the OSImage build inputs are immutable
+func isBuildRunning(o *v1alpha1.OSImage) bool {
+	return o.Status.Phase == v1alpha1.PhaseBuilding || o.Status.Phase == v1alpha1.PhasePublishing
+}
+
+// targetKeys returns the vCenter datacenter keys of the OSImage, as set in the spec
+// and as resolved by the placement.
+func targetKeys(o *v1alpha1.OSImage) map[string]bool {
+	resolved := targetStatus(o)
+	return map[string]bool{
+		o.Spec.VSphereServer + datacenterPath(o.Spec.VsphereDatacenter): true,
+		resolved.Server + resolved.Datacenter:                           true,
+	}
+}
+
+// targetStatus reports the vCenter datacenter and build state of an OSImage
+func targetStatus(o *v1alpha1.OSImage) v1alpha1.OSImageTargetStatus {
+	status := v1alpha1.OSImageTargetStatus{
+		Server:       o.Spec.VSphereServer,
+		Datacenter:   datacenterPath(o.Spec.VsphereDatacenter),
+		OSImage:      o.Name,
+		Phase:        o.Status.Phase,
+		TemplateMoid: builtTemplateMoid(o),
+	}
+	if p := o.Status.Placement; p != nil {
+		status.Server = firstNonEmpty(status.Server, p.Server)
+		status.Datacenter = firstNonEmpty(status.Datacenter, p.Datacenter)
+	}
+	return status
+}
+
+// builtTemplateMoid returns the managed object ID of the template built by the OSImage,
+// templates listed before the build was identified are matched by name.
+func builtTemplateMoid(o *v1alpha1.OSImage) string {
+	if o.Status.BuiltTemplateMoid != "" {
+		return o.Status.BuiltTemplateMoid
+	}
+	templateName := osImageTemplateName(o)
+	for _, t := range o.Status.OSTemplates {
+		if t.Name == templateName {
+			return t.Moid
+		}
+	}
+	return ""
+}
+
+// setTargetsCondition sets the TargetsReady condition from the target phases, it is
+// only reported by the OSImages with additional targets.
+func setTargetsCondition(o *v1alpha1.OSImage) {
+	if len(o.Spec.AdditionalTargets) == 0 {
+		meta.RemoveStatusCondition(&o.Status.Conditions, v1alpha1.ConditionTargetsReady)
+		return
+	}
+	var pending []string
+	for _, t := range o.Status.Targets {
+		if t.Phase != v1alpha1.PhaseSucceeded {
+			pending = append(pending, fmt.Sprintf("%s%s is %s", t.Server, t.Datacenter, phaseOrPending(t.Phase)))
+		}
+	}
+	if len(pending) > 0 {
+		setCondition(o, v1alpha1.ConditionTargetsReady, metav1.ConditionFalse, ReasonTargetsNotReady,
+			fmt.Sprintf("%d/%d targets succeeded: %v.", len(o.Status.Targets)-len(pending), len(o.Status.Targets), pending))
+		return
+	}
+	setCondition(o, v1alpha1.ConditionTargetsReady, metav1.ConditionTrue, ReasonTargetsReady,
+		fmt.Sprintf("template published in %d targets.", len(o.Status.Targets)))
+}
+
+// phaseOrPending returns the phase, Pending for a target not reconciled yet
+func phaseOrPending(phase v1alpha1.OSImagePhase) v1alpha1.OSImagePhase {
+	if phase == "" {
+		return v1alpha1.PhasePending
+	}
+	return phase
+}
+
+// requestsForParentOSImage maps a target OSImage event to the OSImage owning it
+func requestsForParentOSImage(object client.Object) []ctrl.Request {
+	owner := metav1.GetControllerOf(object)
+	if owner == nil || owner.Kind != "OSImage" {
+		return nil
+	}
+	return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: object.GetNamespace(), Name: owner.Name}}}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Additional targets", func() {
+	var (
+		ctx        = context.Background()
+		reconciler *OSImageReconciler
+		o          *imagebuilderv1alpha1.OSImage
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(imagebuilderv1alpha1.AddToScheme(scheme)).To(Succeed())
+		o = newOSImage("windows")
+		o.UID = types.UID("0b6f6d4e-7d4c-4bb8-9f43-6b5d8b0c2a11")
+		o.Spec.CredentialsRef = &v1.LocalObjectReference{Name: "image-builder"}
+		o.Spec.AdditionalTargets = []imagebuilderv1alpha1.VSphereTarget{
+			{Server: "10.0.0.2", Datacenter: "/dc0", Folder: "/dc0/vm/windows"},
+			{Server: "10.0.0.3", CredentialsRef: &v1.LocalObjectReference{Name: "vc3"}},
+		}
+		o.Status.Phase = imagebuilderv1alpha1.PhaseSucceeded
+		o.Status.Placement = &imagebuilderv1alpha1.OSImagePlacement{Server: "10.0.0.1", Datacenter: "/dc0"}
+		reconciler = &OSImageReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(o).Build(),
+			Scheme: scheme,
+		}
+	})
+
+	listTargets := func() []imagebuilderv1alpha1.OSImage {
+		children := &imagebuilderv1alpha1.OSImageList{}
+		Expect(reconciler.List(ctx, children, client.MatchingLabels{LabelParentOSImageUID: string(o.UID)})).To(Succeed())
+		return children.Items
+	}
+
+	It("should create an OSImage per target", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		children := listTargets()
+		Expect(children).To(HaveLen(2))
+		for _, child := range children {
+			Expect(metav1.IsControlledBy(&child, o)).To(BeTrue())
+			Expect(child.Spec.AdditionalTargets).To(BeEmpty())
+			Expect(child.Spec.WindowsISOPath).To(Equal(o.Spec.WindowsISOPath))
+		}
+
+		child := &imagebuilderv1alpha1.OSImage{}
+		key := types.NamespacedName{Namespace: "default", Name: targetOSImageName(o, o.Spec.AdditionalTargets[1])}
+		Expect(reconciler.Get(ctx, key, child)).To(Succeed())
+		Expect(child.Spec.VSphereServer).To(Equal("10.0.0.3"))
+		Expect(child.Spec.CredentialsRef.Name).To(Equal("vc3"))
+	})
+
+	It("should report the state of every vCenter", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		Expect(o.Status.Targets).To(HaveLen(3))
+		Expect(o.Status.Targets[0]).To(Equal(imagebuilderv1alpha1.OSImageTargetStatus{
+			Server: "10.0.0.1", Datacenter: "/dc0", OSImage: "windows", Phase: imagebuilderv1alpha1.PhaseSucceeded,
+		}))
+		Expect(o.Status.Targets[1].Server).To(Equal("10.0.0.2"))
+		Expect(o.Status.Targets[1].Datacenter).To(Equal("/dc0"))
+		Expect(meta.IsStatusConditionFalse(o.Status.Conditions, imagebuilderv1alpha1.ConditionTargetsReady)).To(BeTrue())
+
+		for i := range o.Status.Targets {
+			o.Status.Targets[i].Phase = imagebuilderv1alpha1.PhaseSucceeded
+		}
+		setTargetsCondition(o)
+		Expect(meta.IsStatusConditionTrue(o.Status.Conditions, imagebuilderv1alpha1.ConditionTargetsReady)).To(BeTrue())
+	})
+
+	It("should delete the OSImages of removed targets", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+		o.Spec.AdditionalTargets = o.Spec.AdditionalTargets[:1]
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		children := listTargets()
+		Expect(children).To(HaveLen(1))
+		Expect(children[0].Spec.VSphereServer).To(Equal("10.0.0.2"))
+		Expect(children[0].Spec.CredentialsRef.Name).To(Equal("image-builder"))
+	})
+
+	It("should skip the targets of the resolved OSImage vCenter datacenter", func() {
+		o.Spec.AdditionalTargets = append(o.Spec.AdditionalTargets, imagebuilderv1alpha1.VSphereTarget{Server: "10.0.0.1", Datacenter: "dc0"})
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		Expect(listTargets()).To(HaveLen(2))
+		Expect(o.Status.Targets).To(HaveLen(3))
+	})
+
+	It("should update a building target after its build", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+		for _, child := range listTargets() {
+			child.Status.Phase = imagebuilderv1alpha1.PhaseBuilding
+			Expect(reconciler.Status().Update(ctx, &child)).To(Succeed())
+		}
+		reconciler.Client = &rejectUpdateClient{Client: reconciler.Client}
+		o.Spec.KubernetesVersion = "v1.24.0"
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		Expect(o.Status.Targets).To(HaveLen(3))
+		Expect(o.Status.Targets[1].Phase).To(Equal(imagebuilderv1alpha1.PhaseBuilding))
+		for _, child := range listTargets() {
+			Expect(child.Spec.KubernetesVersion).To(Equal("v1.23.8"))
+		}
+	})
+
+	It("should fail when a target rejects the update", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+		reconciler.Client = &rejectUpdateClient{Client: reconciler.Client}
+		o.Spec.KubernetesVersion = "v1.24.0"
+		Expect(reconciler.reconcileTargets(ctx, o)).To(MatchError(ContainSubstring("immutable while the OSImage is Building")))
+	})
+
+	It("should keep the target specs in sync", func() {
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+		o.Spec.KubernetesVersion = "v1.24.0"
+		Expect(reconciler.reconcileTargets(ctx, o)).To(Succeed())
+
+		for _, child := range listTargets() {
+			Expect(child.Spec.KubernetesVersion).To(Equal("v1.24.0"))
+		}
+	})
+})
+
+// rejectUpdateClient rejects the updates like the webhook does for a building OSImage
+type rejectUpdateClient struct {
+	client.Client
+}
+
+func (c *rejectUpdateClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return apierrors.NewInvalid(imagebuilderv1alpha1.GroupVersion.WithKind("OSImage").GroupKind(), obj.GetName(), field.ErrorList{
+		field.Forbidden(field.NewPath("spec", "kubernetesVersion"), "immutable while the OSImage is Building"),
+	})
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// DefaultTemplateResyncInterval is the period between two listings of the vSphere
+// templates of the OSImages without templateResyncInterval.
+const DefaultTemplateResyncInterval = 30 * time.Minute
+
+// Event reasons of the vSphere template changes
+const (
+	EventTemplateAdded   = "TemplateAdded"
+	EventTemplateRemoved = "TemplateRemoved"
+	EventTemplateChanged = "TemplateChanged"
+)
+
+// templateResyncInterval returns the OSImage resync interval, or the controller one
+func (r *OSImageReconciler) templateResyncInterval(o *v1alpha1.OSImage) time.Duration {
+	if o.Spec.TemplateResyncInterval != nil {
+		return o.Spec.TemplateResyncInterval.Duration
+	}
+	return r.TemplateResyncInterval
+}
+
+// nextTemplateSync returns the time left until the templates are listed again, the
+// resync is disabled when the interval is not positive.
+func nextTemplateSync(o *v1alpha1.OSImage, interval time.Duration, now time.Time) (time.Duration, bool) {
+	if interval <= 0 {
+		return 0, false
+	}
+	if o.Status.LastTemplateSync == nil {
+		return 0, true
+	}
+	if left := o.Status.LastTemplateSync.Add(interval).Sub(now); left > 0 {
+		return left, true
+	}
+	return 0, true
+}
+
+// templateChange is a template added, removed or changed in vSphere
+type templateChange struct {
+	eventType, reason, message string
+}
+
+// diffTemplates compares the templates by managed object ID, renamed and moved
+// templates keep their ID and are reported as changed.
+func diffTemplates(old, current []v1alpha1.OSImageTemplates) []templateChange {
+	var changes []templateChange
+	previous := make(map[string]v1alpha1.OSImageTemplates, len(old))
+	for _, t := range old {
+		previous[t.Moid] = t
+	}
+
+	for _, t := range current {
+		before, ok := previous[t.Moid]
+		if !ok {
+			changes = append(changes, templateChange{v1.EventTypeNormal, EventTemplateAdded,
+				fmt.Sprintf("template %s (%s) added in vSphere.", t.Name, t.Moid)})
+			continue
+		}
+		delete(previous, t.Moid)
+		if fields := changedTemplateFields(before, t); len(fields) > 0 {
+			changes = append(changes, templateChange{v1.EventTypeNormal, EventTemplateChanged,
+				fmt.Sprintf("template %s (%s) changed in vSphere: %s.", t.Name, t.Moid, strings.Join(fields, ", "))})
+		}
+	}
+
+	// Removals are reported in the order of the previous listing.
+	for _, t := range old {
+		if _, ok := previous[t.Moid]; ok {
+			changes = append(changes, templateChange{v1.EventTypeWarning, EventTemplateRemoved,
+				fmt.Sprintf("template %s (%s) removed from vSphere.", t.Name, t.Moid)})
+		}
+	}
+	return changes
+}
+
+// changedTemplateFields describes the changed fields of a template
+func changedTemplateFields(before, after v1alpha1.OSImageTemplates) []string {
+	var fields []string
+	if before.Name != after.Name {
+		fields = append(fields, fmt.Sprintf("renamed from %s", before.Name))
+	}
+	if before.FolderMoid != after.FolderMoid {
+		fields = append(fields, fmt.Sprintf("moved from folder %s to %s", before.FolderMoid, after.FolderMoid))
+	}
+
+	// The Windows version and edition are only known for the template built by the OSImage.
+	before.Name, before.FolderMoid = after.Name, after.FolderMoid
+	before.WindowsVersion, before.WindowsEdition = after.WindowsVersion, after.WindowsEdition
+	if before != after {
+		fields = append(fields, "vApp properties updated")
+	}
+	return fields
+}
+
+// hasTemplate returns true when a template has the managed object ID
+func hasTemplate(templates []v1alpha1.OSImageTemplates, moid string) bool {
+	for _, t := range templates {
+		if t.Moid == moid {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTemplateChanges emits an Event on the OSImage for each template change
+func (r *OSImageReconciler) recordTemplateChanges(o *v1alpha1.OSImage, changes []templateChange) {
+	if r.Recorder == nil {
+		return
+	}
+	for _, c := range changes {
+		r.Recorder.Event(o, c.eventType, c.reason, c.message)
+	}
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("vSphere template resync", func() {
+	template := imagebuilderv1alpha1.OSImageTemplates{
+		Name:             "windows-2019-kube-v1.23.8",
+		Moid:             "vm-42",
+		FolderMoid:       "group-v3",
+		KubernetesSemVer: "v1.23.8+vmware.2",
+	}
+
+	DescribeTable("comparing the templates",
+		func(change func(*imagebuilderv1alpha1.OSImageTemplates), reason, message string) {
+			changed := template
+			change(&changed)
+			changes := diffTemplates([]imagebuilderv1alpha1.OSImageTemplates{template}, []imagebuilderv1alpha1.OSImageTemplates{changed})
+			if reason == "" {
+				Expect(changes).To(BeEmpty())
+				return
+			}
+			Expect(changes).To(Equal([]templateChange{{v1.EventTypeNormal, reason, message}}))
+		},
+		Entry("unchanged", func(t *imagebuilderv1alpha1.OSImageTemplates) {}, "", ""),
+		Entry("built by the OSImage", func(t *imagebuilderv1alpha1.OSImageTemplates) {
+			t.WindowsVersion, t.WindowsEdition = "2019", "core"
+		}, "", ""),
+		Entry("renamed", func(t *imagebuilderv1alpha1.OSImageTemplates) { t.Name = "windows-2019" },
+			EventTemplateChanged, "template windows-2019 (vm-42) changed in vSphere: renamed from windows-2019-kube-v1.23.8."),
+		Entry("moved", func(t *imagebuilderv1alpha1.OSImageTemplates) { t.FolderMoid = "group-v9" },
+			EventTemplateChanged, "template windows-2019-kube-v1.23.8 (vm-42) changed in vSphere: moved from folder group-v3 to group-v9."),
+		Entry("vApp properties", func(t *imagebuilderv1alpha1.OSImageTemplates) { t.KubernetesSemVer = "v1.23.8+vmware.3" },
+			EventTemplateChanged, "template windows-2019-kube-v1.23.8 (vm-42) changed in vSphere: vApp properties updated."),
+	)
+
+	It("should report the added and removed templates", func() {
+		added := imagebuilderv1alpha1.OSImageTemplates{Name: "ubuntu-2004-kube-v1.23.8", Moid: "vm-50"}
+		changes := diffTemplates([]imagebuilderv1alpha1.OSImageTemplates{template}, []imagebuilderv1alpha1.OSImageTemplates{added})
+		Expect(changes).To(Equal([]templateChange{
+			{v1.EventTypeNormal, EventTemplateAdded, "template ubuntu-2004-kube-v1.23.8 (vm-50) added in vSphere."},
+			{v1.EventTypeWarning, EventTemplateRemoved, "template windows-2019-kube-v1.23.8 (vm-42) removed from vSphere."},
+		}))
+	})
+
+	Describe("scheduling the resync", func() {
+		var (
+			o   *imagebuilderv1alpha1.OSImage
+			now = time.Now()
+		)
+
+		BeforeEach(func() {
+			o = newOSImage("windows")
+		})
+
+		It("should be disabled without interval", func() {
+			_, ok := nextTemplateSync(o, 0, now)
+			Expect(ok).To(BeFalse())
+		})
+		It("should be due without a previous listing", func() {
+			left, ok := nextTemplateSync(o, time.Hour, now)
+			Expect(ok).To(BeTrue())
+			Expect(left).To(BeZero())
+		})
+		It("should wait for the interval since the last listing", func() {
+			o.Status.LastTemplateSync = &metav1.Time{Time: now.Add(-20 * time.Minute)}
+			left, ok := nextTemplateSync(o, 30*time.Minute, now)
+			Expect(ok).To(BeTrue())
+			Expect(left).To(Equal(10 * time.Minute))
+
+			left, _ = nextTemplateSync(o, 10*time.Minute, now)
+			Expect(left).To(BeZero())
+		})
+		It("should prefer the OSImage interval", func() {
+			reconciler := &OSImageReconciler{TemplateResyncInterval: DefaultTemplateResyncInterval}
+			Expect(reconciler.templateResyncInterval(o)).To(Equal(DefaultTemplateResyncInterval))
+			o.Spec.TemplateResyncInterval = &metav1.Duration{}
+			Expect(reconciler.templateResyncInterval(o)).To(BeZero())
+		})
+	})
+})
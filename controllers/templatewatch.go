@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefaultTemplateWatchBackoff spaces the reconnections of the template watch, from a
+// second up to 5 minutes.
+var DefaultTemplateWatchBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.2,
+	Steps:    10,
+	Cap:      5 * time.Minute,
+}
+
+// minTemplateWatchDuration is the duration of a subscription resetting the backoff
+const minTemplateWatchDuration = time.Minute
+
+// TemplateWatcher subscribes to the virtual machine changes of the vCenter datacenters
+// of the default credentials, the OSImages of a datacenter are reconciled as soon as a
+// template changes. The OSImages of other vCenters rely on the template resync.
+type TemplateWatcher struct {
+	// Client lists the OSImages to reconcile
+	Client client.Client
+
+	// Credentials loads the vSphere credentials, it defaults to the
+	// vsphere-cloud-config credentials read with the client.
+	Credentials *Credentials
+
+	// VSphereClients returns the vCenter clients
+	VSphereClients vsphere.ClientFactory
+
+	// Events receives the OSImages to reconcile, it is the channel source of the
+	// OSImage controller.
+	Events chan event.GenericEvent
+
+	// Backoff spaces the reconnections, DefaultTemplateWatchBackoff when zero
+	Backoff wait.Backoff
+
+	mu sync.Mutex
+	// changes is the last template change by vCenter and datacenter path
+	changes map[string]time.Time
+}
+
+// NewTemplateWatcher returns a watcher sending the OSImages to reconcile on its Events channel
+func NewTemplateWatcher(c client.Client, credentials *Credentials, clients vsphere.ClientFactory) *TemplateWatcher {
+	return &TemplateWatcher{
+		Client:         c,
+		Credentials:    credentials,
+		VSphereClients: clients,
+		Events:         make(chan event.GenericEvent),
+		Backoff:        DefaultTemplateWatchBackoff,
+	}
+}
+
+// Start watches the templates until the manager stops, the subscriptions are opened
+// again with backoff when the session drops. It implements the Runnable interface.
+func (w *TemplateWatcher) Start(ctx context.Context) error {
+	backoff := w.backoff()
+	for {
+		started := time.Now()
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(started) >= minTemplateWatchDuration {
+			backoff = w.backoff()
+		}
+		delay := backoff.Step()
+		log.FromContext(ctx).Error(err, "vCenter template watch stopped, reconnecting.", "after", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the reconnection backoff from its first step
+func (w *TemplateWatcher) backoff() wait.Backoff {
+	if w.Backoff.Duration == 0 {
+		return DefaultTemplateWatchBackoff
+	}
+	return w.Backoff
+}
+
+// watch subscribes to the datacenters of the default credentials, it returns the
+// error of the first subscription to stop.
+func (w *TemplateWatcher) watch(ctx context.Context) error {
+	cmap := &config.Mapper{}
+	if _, _, err := credentialsOrDefault(w.Credentials, w.Client).Load(ctx, nil, cmap); err != nil {
+		return err
+	}
+	vc, release, err := login(ctx, w.VSphereClients, cmap)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// All the datacenters are watched when the credentials have none.
+	var datacenters []*models.VSphereDatacenter
+	if name := cmap.Get(vsphere.VsphereDataCenter); name != "" {
+		dc, err := vsphere.FilterDatacenter(ctx, vc, name)
+		if err != nil {
+			return err
+		}
+		if dc == nil {
+			return fmt.Errorf("datacenter %s not found", name)
+		}
+		datacenters = append(datacenters, dc)
+	} else if datacenters, err = vc.GetDatacenters(ctx); err != nil {
+		return err
+	}
+	if len(datacenters) == 0 {
+		return fmt.Errorf("vCenter %s has no datacenter to watch", cmap.Get(vsphere.VsphereServer))
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	server := cmap.Get(vsphere.VsphereServer)
+	errs := make(chan error, len(datacenters))
+	for _, dc := range datacenters {
+		dc := dc
+		go func() {
+			errs <- vc.WatchVirtualMachines(watchCtx, dc.Moid, func(updates []vsphere.VirtualMachineUpdate) {
+				w.templatesChanged(watchCtx, server, dc.Name, updates)
+			})
+		}()
+	}
+	log.FromContext(ctx).Info("Watching the vCenter templates.", "server", server, "datacenters", len(datacenters))
+
+	// The other subscriptions are stopped with the first error.
+	err = <-errs
+	cancel()
+	for i := 1; i < len(datacenters); i++ {
+		<-errs
+	}
+	return err
+}
+
+// templatesChanged records the change and sends the OSImages of the datacenter to
+// reconcile, all of them list the datacenter templates.
+func (w *TemplateWatcher) templatesChanged(ctx context.Context, server, datacenter string, updates []vsphere.VirtualMachineUpdate) {
+	logger := log.FromContext(ctx)
+	for _, u := range updates {
+		logger.Info("vCenter template changed.", "server", server, "datacenter", datacenter,
+			"template", u.Name, "moid", u.Moid, "removed", u.Removed)
+	}
+
+	w.mu.Lock()
+	if w.changes == nil {
+		w.changes = map[string]time.Time{}
+	}
+	w.changes[server+datacenterPath(datacenter)] = time.Now()
+	w.mu.Unlock()
+
+	images := &v1alpha1.OSImageList{}
+	if err := w.Client.List(ctx, images); err != nil {
+		logger.Error(err, "unable to list the OSImages")
+		return
+	}
+	for i := range images.Items {
+		o := &images.Items[i]
+		if p := o.Status.Placement; p == nil || p.Server != server || datacenterPath(p.Datacenter) != datacenterPath(datacenter) {
+			continue
+		}
+		select {
+		case w.Events <- event.GenericEvent{Object: o}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ChangedSince returns true when a template of the vCenter datacenter changed after the time
+func (w *TemplateWatcher) ChangedSince(server, datacenter string, since time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changed, ok := w.changes[server+datacenterPath(datacenter)]
+	return ok && !changed.Before(since)
+}
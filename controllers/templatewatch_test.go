@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("vCenter template watch", func() {
+	var (
+		vc      *fake.Client
+		clients *fake.ClientFactory
+		watcher *TemplateWatcher
+		cancel  context.CancelFunc
+		stopped chan error
+	)
+
+	// placedOSImage returns an OSImage built in the vCenter datacenter
+	placedOSImage := func(name, server, datacenter string) *imagebuilderv1alpha1.OSImage {
+		o := newOSImage(name)
+		o.Status.Placement = &imagebuilderv1alpha1.OSImagePlacement{Server: server, Datacenter: datacenter}
+		return o
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(imagebuilderv1alpha1.AddToScheme(scheme)).To(Succeed())
+		c := clientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "vsphere-credentials", Namespace: "default"},
+				Data: map[string][]byte{
+					CredentialsServerKey:   []byte("10.0.0.1"),
+					CredentialsUsernameKey: []byte("administrator@vsphere.local"),
+					CredentialsPasswordKey: []byte("secret"),
+				},
+			},
+			placedOSImage("windows", "10.0.0.1", "dc0"),
+			placedOSImage("windows-dc1", "10.0.0.1", "/dc1"),
+			placedOSImage("windows-vc2", "10.0.0.2", "/dc0"),
+			newOSImage("pending"),
+		).Build()
+
+		vc = fake.NewClient()
+		vc.AddDatacenter("datacenter-2", "/dc0")
+		vc.AddDatacenter("datacenter-3", "/dc1")
+		clients = fake.NewClientFactory("10.0.0.1", vc)
+		watcher = NewTemplateWatcher(c, &Credentials{
+			Reader:        c,
+			DefaultSecret: &types.NamespacedName{Namespace: "default", Name: "vsphere-credentials"},
+		}, clients)
+		watcher.Events = make(chan event.GenericEvent, 10)
+		watcher.Backoff = wait.Backoff{Duration: 10 * time.Millisecond, Factor: 2, Steps: 3, Cap: 50 * time.Millisecond}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		stopped = make(chan error)
+		go func() {
+			stopped <- watcher.Start(ctx)
+		}()
+		DeferCleanup(func() {
+			cancel()
+			Eventually(stopped).Should(Receive(BeNil()))
+		})
+		Eventually(func() int { return vc.Watches("datacenter-2") + vc.Watches("datacenter-3") }).Should(Equal(2))
+	})
+
+	It("should reconcile the OSImages of the changed datacenter", func() {
+		since := time.Now()
+		Expect(watcher.ChangedSince("10.0.0.1", "/dc0", since)).To(BeFalse())
+
+		vc.Notify("datacenter-2", vsphere.VirtualMachineUpdate{Moid: "vm-42", Name: "windows-2019-kube-v1.23.8", Template: true})
+		var e event.GenericEvent
+		Eventually(watcher.Events).Should(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal("windows"))
+		Consistently(watcher.Events, "100ms").ShouldNot(Receive())
+
+		Expect(watcher.ChangedSince("10.0.0.1", "dc0", since)).To(BeTrue())
+		Expect(watcher.ChangedSince("10.0.0.1", "/dc1", since)).To(BeFalse())
+		Expect(watcher.ChangedSince("10.0.0.2", "/dc0", since)).To(BeFalse())
+	})
+
+	It("should reconnect when the session drops", func() {
+		Expect(clients.Logins()).To(HaveLen(1))
+		vc.DropWatches()
+		Eventually(func() int { return vc.Watches("datacenter-2") }).Should(Equal(1))
+		Expect(clients.Logins()).To(HaveLen(2))
+		Expect(clients.Held()).To(Equal(1))
+
+		vc.Notify("datacenter-3", vsphere.VirtualMachineUpdate{Moid: "vm-43", Name: "windows-2022", Removed: true})
+		var e event.GenericEvent
+		Eventually(watcher.Events).Should(Receive(&e))
+		Expect(e.Object.GetName()).To(Equal("windows-dc1"))
+	})
+
+	It("should force the listing of the changed templates", func() {
+		o := placedOSImage("windows", "10.0.0.1", "/dc0")
+		reconciler := &OSImageReconciler{TemplateWatcher: watcher}
+		Expect(reconciler.templatesChanged(o)).To(BeFalse())
+
+		synced := metav1.NewTime(time.Now().Add(-time.Minute))
+		o.Status.LastTemplateSync = &synced
+		Expect(reconciler.templatesChanged(o)).To(BeFalse())
+
+		vc.Notify("datacenter-2", vsphere.VirtualMachineUpdate{Moid: "vm-42", Name: "windows-2019", Template: true})
+		Eventually(watcher.Events).Should(Receive())
+		Expect(reconciler.templatesChanged(o)).To(BeTrue())
+
+		synced = metav1.NewTime(time.Now().Add(time.Second))
+		Expect(reconciler.templatesChanged(o)).To(BeFalse())
+	})
+})
@@ -0,0 +1,284 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// defaultInventoryRefreshInterval is used when the spec does not set one
+	defaultInventoryRefreshInterval = 10 * time.Minute
+
+	// DefaultInventoryName is the VSphereInventory created when the controller starts
+	DefaultInventoryName = "vsphere"
+
+	ReasonInventorySynced     = "InventorySynced"
+	ReasonInventoryFailed     = "InventoryFailed"
+	ReasonInventoryIncomplete = "InventoryIncomplete"
+)
+
+// VSphereInventoryReconciler reconciles a VSphereInventory object
+type VSphereInventoryReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// Credentials loads the default vSphere credentials
+	Credentials *Credentials
+
+	// VSphereClients returns the vCenter clients, the vsphere.Sessions cache reuses
+	// the sessions across reconciles. It is required to connect to vCenter.
+	VSphereClients vsphere.ClientFactory
+
+	// DefaultInventory is the name of the VSphereInventory created once the manager
+	// starts, none is created when empty.
+	DefaultInventory string
+}
+
+//+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=vsphereinventories,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=imagebuilder.tanzu.opssec.in,resources=vsphereinventories/status,verbs=get;update;patch
+
+func (r *VSphereInventoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling object.", "req", req.NamespacedName)
+
+	var inventory imagebuilderv1alpha1.VSphereInventory
+	if err := r.Get(ctx, req.NamespacedName, &inventory); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("Resource not found.")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	refreshInterval := defaultInventoryRefreshInterval
+	if inventory.Spec.RefreshInterval != nil && inventory.Spec.RefreshInterval.Duration > 0 {
+		refreshInterval = inventory.Spec.RefreshInterval.Duration
+	}
+
+	// A failed discovery keeps the last inventory and is retried on the next refresh,
+	// the datacenters failing on their own are reported in their error.
+	if failed, err := r.discover(ctx, &inventory); err != nil {
+		logger.Error(err, "unable to discover the vSphere inventory")
+		setInventoryCondition(&inventory, metav1.ConditionFalse, ReasonInventoryFailed,
+			fmt.Sprintf("unable to discover the vSphere inventory: %s", err.Error()))
+	} else {
+		now := metav1.Now()
+		inventory.Status.LastSyncTime = &now
+		if len(failed) > 0 {
+			setInventoryCondition(&inventory, metav1.ConditionFalse, ReasonInventoryIncomplete,
+				fmt.Sprintf("unable to discover the datacenters %v, see their error.", failed))
+		} else {
+			setInventoryCondition(&inventory, metav1.ConditionTrue, ReasonInventorySynced,
+				fmt.Sprintf("found %d datacenters.", len(inventory.Status.Datacenters)))
+		}
+	}
+
+	if err := r.Status().Update(ctx, &inventory); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: refreshInterval}, nil
+}
+
+// discover lists the inventory of all datacenters seen with the vsphere-cloud-config
+// credentials, the paths of the datacenters that failed are returned.
+func (r *VSphereInventoryReconciler) discover(ctx context.Context, inventory *imagebuilderv1alpha1.VSphereInventory) ([]string, error) {
+	var cmap = &config.Mapper{}
+	if _, _, err := credentialsOrDefault(r.Credentials, r.Client).Load(ctx, nil, cmap); err != nil {
+		return nil, err
+	}
+	inventory.Status.Server = cmap.Get(vsphere.VsphereServer)
+
+	vc, release, err := login(ctx, r.VSphereClients, cmap)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	dcs, err := vc.GetDatacenters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []string
+	inventory.Status.Datacenters, failed = discoverDatacenters(ctx, vc, dcs, inventory.Status.Datacenters)
+	return failed, nil
+}
+
+// discoverDatacenters lists the objects of every datacenter. A datacenter that fails
+// keeps its objects of the previous discovery and reports the failure in its error,
+// the paths of the failed datacenters are returned.
+func discoverDatacenters(ctx context.Context, vc vsphere.Client, dcs []*models.VSphereDatacenter, previous []imagebuilderv1alpha1.InventoryDatacenter) ([]imagebuilderv1alpha1.InventoryDatacenter, []string) {
+	var failed []string
+	datacenters := make([]imagebuilderv1alpha1.InventoryDatacenter, 0, len(dcs))
+	for _, dc := range dcs {
+		datacenter, err := discoverDatacenter(ctx, vc, dc)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "unable to discover the datacenter", "datacenter", dc.Name)
+			failed = append(failed, dc.Name)
+			datacenter = &imagebuilderv1alpha1.InventoryDatacenter{
+				InventoryObject: imagebuilderv1alpha1.InventoryObject{Name: path.Base(dc.Name), Moid: dc.Moid, Path: dc.Name},
+			}
+			for _, p := range previous {
+				if p.Moid == dc.Moid {
+					datacenter = p.DeepCopy()
+					break
+				}
+			}
+			datacenter.Error = err.Error()
+		}
+		datacenters = append(datacenters, *datacenter)
+	}
+	return datacenters, failed
+}
+
+// discoverDatacenter lists the objects of a datacenter usable in the OSImage spec
+func discoverDatacenter(ctx context.Context, vc vsphere.Client, dc *models.VSphereDatacenter) (*imagebuilderv1alpha1.InventoryDatacenter, error) {
+	// GetDatacenters returns the datacenter path as its name.
+	datacenter := &imagebuilderv1alpha1.InventoryDatacenter{
+		InventoryObject: imagebuilderv1alpha1.InventoryObject{Name: path.Base(dc.Name), Moid: dc.Moid, Path: dc.Name},
+	}
+
+	var err error
+	lists := []struct {
+		objects *[]imagebuilderv1alpha1.InventoryObject
+		list    func(context.Context, string) ([]*models.VSphereManagementObject, error)
+	}{
+		{&datacenter.Clusters, vc.GetClusters},
+		{&datacenter.ResourcePools, vc.GetResourcePools},
+		{&datacenter.Folders, vc.GetFolders},
+		{&datacenter.Networks, vc.GetNetworks},
+	}
+	for _, l := range lists {
+		if *l.objects, err = listInventoryObjects(ctx, dc.Moid, l.list); err != nil {
+			return nil, err
+		}
+	}
+
+	datastores, err := listInventoryObjects(ctx, dc.Moid, vc.GetDatastores)
+	if err != nil {
+		return nil, err
+	}
+	capacities, err := vc.GetDatastoreCapacities(ctx, dc.Moid)
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range datastores {
+		capacity := capacities[ds.Moid]
+		datacenter.Datastores = append(datacenter.Datastores, imagebuilderv1alpha1.InventoryDatastore{
+			InventoryObject: ds,
+			Capacity:        *resource.NewQuantity(capacity.Capacity, resource.BinarySI),
+			FreeSpace:       *resource.NewQuantity(capacity.FreeSpace, resource.BinarySI),
+		})
+	}
+	return datacenter, nil
+}
+
+// listInventoryObjects converts the discovered management objects
+func listInventoryObjects(ctx context.Context, datacenterMOID string, list func(context.Context, string) ([]*models.VSphereManagementObject, error)) ([]imagebuilderv1alpha1.InventoryObject, error) {
+	objects, err := list(ctx, datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]imagebuilderv1alpha1.InventoryObject, len(objects))
+	for i, obj := range objects {
+		results[i] = imagebuilderv1alpha1.InventoryObject{Name: obj.Name, Moid: obj.Moid, Path: obj.Path}
+	}
+	return results, nil
+}
+
+// setInventoryCondition sets the Synced condition on the current VSphereInventory generation
+func setInventoryCondition(inventory *imagebuilderv1alpha1.VSphereInventory, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&inventory.Status.Conditions, metav1.Condition{
+		Type:               imagebuilderv1alpha1.ConditionInventorySynced,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: inventory.Generation,
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	})
+}
+
+// createDefaultInventory creates the default VSphereInventory when it is missing, an
+// inventory deleted by hand is created again on the next controller start.
+func (r *VSphereInventoryReconciler) createDefaultInventory(ctx context.Context) error {
+	inventory := &imagebuilderv1alpha1.VSphereInventory{ObjectMeta: metav1.ObjectMeta{Name: r.DefaultInventory}}
+	if err := r.Create(ctx, inventory); errors.IsAlreadyExists(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to create the %s vSphere inventory: %v", r.DefaultInventory, err)
+	}
+	log.FromContext(ctx).Info("Created the vSphere inventory.", "name", r.DefaultInventory)
+	return nil
+}
+
+// defaultInventoryBackoff spaces the attempts to create the default VSphereInventory
+var defaultInventoryBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Cap: 2 * time.Minute, Steps: math.MaxInt32}
+
+// ensureDefaultInventory creates the default VSphereInventory once the manager starts.
+// Transient API errors, like a webhook not ready yet, are logged and retried with a
+// backoff so they do not stop the manager.
+func (r *VSphereInventoryReconciler) ensureDefaultInventory(ctx context.Context) error {
+	backoff := defaultInventoryBackoff
+	for {
+		err := r.createDefaultInventory(ctx)
+		if err == nil {
+			return nil
+		}
+		delay := backoff.Step()
+		log.FromContext(ctx).Error(err, "unable to create the default vSphere inventory, retrying.", "after", delay)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager, status updates are
+// filtered out so the discovery only runs on spec changes and refreshes.
+func (r *VSphereInventoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.DefaultInventory != "" {
+		if err := mgr.Add(manager.RunnableFunc(r.ensureDefaultInventory)); err != nil {
+			return err
+		}
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&imagebuilderv1alpha1.VSphereInventory{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
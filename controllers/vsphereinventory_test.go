@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/fake"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("vSphere inventory discovery", func() {
+	var (
+		ctx = context.Background()
+		vc  *fake.Client
+		dc  *fake.Datacenter
+	)
+
+	BeforeEach(func() {
+		vc = fake.NewClient()
+		dc = vc.AddDatacenter("datacenter-2", "/dc0")
+		dc.Objects = []*models.VSphereManagementObject{
+			{Moid: "domain-c7", Name: "cluster0", Path: "/dc0/host/cluster0", ResourceType: models.VSphereManagementObjectResourceTypeCluster},
+			{Moid: "resgroup-8", Name: "Resources", Path: "/dc0/host/cluster0/Resources", ResourceType: models.VSphereManagementObjectResourceTypeRespool},
+			{Moid: "group-v3", Name: "vm", Path: "/dc0/vm", ResourceType: models.VSphereManagementObjectResourceTypeFolder},
+			{Moid: "network-9", Name: "VM Network", Path: "/dc0/network/VM Network", ResourceType: models.VSphereManagementObjectResourceTypeNetwork},
+			{Moid: "datastore-10", Name: "ds0", Path: "/dc0/datastore/ds0", ResourceType: models.VSphereManagementObjectResourceTypeDatastore},
+			{Moid: "datastore-11", Name: "ds1", Path: "/dc0/datastore/ds1", ResourceType: models.VSphereManagementObjectResourceTypeDatastore},
+		}
+		dc.Capacities["datastore-10"] = vsphere.DatastoreCapacity{Capacity: 100 << 30, FreeSpace: 10 << 30}
+		dc.Capacities["datastore-11"] = vsphere.DatastoreCapacity{Capacity: 100 << 30, FreeSpace: 60 << 30}
+	})
+
+	It("should list the datacenter objects", func() {
+		datacenter, err := discoverDatacenter(ctx, vc, vc.Datacenters[0])
+		Expect(err).To(BeNil())
+		Expect(datacenter.Name).To(Equal("dc0"))
+		Expect(datacenter.Path).To(Equal("/dc0"))
+		Expect(datacenter.Clusters).To(HaveLen(1))
+		Expect(datacenter.ResourcePools[0].Path).To(Equal("/dc0/host/cluster0/Resources"))
+		Expect(datacenter.Folders[0].Moid).To(Equal("group-v3"))
+		Expect(datacenter.Networks[0].Name).To(Equal("VM Network"))
+		Expect(datacenter.Datastores).To(HaveLen(2))
+		Expect(datacenter.Datastores[1].FreeSpace).To(Equal(*resource.NewQuantity(60<<30, resource.BinarySI)))
+	})
+
+	It("should fail when a list fails", func() {
+		vc.Errors["GetNetworks"] = fmt.Errorf("permission denied")
+		_, err := discoverDatacenter(ctx, vc, vc.Datacenters[0])
+		Expect(err).To(MatchError("permission denied"))
+	})
+
+	It("should publish the datacenters that succeed", func() {
+		vc.AddDatacenter("datacenter-3", "/dc1")
+		failing := &failingDatacenterClient{Client: vc, moid: "datacenter-3"}
+		previous := []imagebuilderv1alpha1.InventoryDatacenter{{
+			InventoryObject: imagebuilderv1alpha1.InventoryObject{Name: "dc1", Moid: "datacenter-3", Path: "/dc1"},
+			Folders:         []imagebuilderv1alpha1.InventoryObject{{Name: "vm", Moid: "group-v4", Path: "/dc1/vm"}},
+		}}
+
+		datacenters, failed := discoverDatacenters(ctx, failing, vc.Datacenters, previous)
+		Expect(failed).To(Equal([]string{"/dc1"}))
+		Expect(datacenters).To(HaveLen(2))
+		Expect(datacenters[0].Error).To(BeEmpty())
+		Expect(datacenters[0].Datastores).To(HaveLen(2))
+		Expect(datacenters[1].Error).To(Equal("permission denied"))
+		Expect(datacenters[1].Folders).To(Equal(previous[0].Folders))
+		Expect(previous[0].Error).To(BeEmpty())
+
+		// A datacenter without a previous discovery is reported empty.
+		datacenters, _ = discoverDatacenters(ctx, failing, vc.Datacenters, nil)
+		Expect(datacenters[1].InventoryObject).To(Equal(previous[0].InventoryObject))
+		Expect(datacenters[1].Folders).To(BeEmpty())
+		Expect(datacenters[1].Error).To(Equal("permission denied"))
+	})
+
+	It("should pick the datastore with the most free space", func() {
+		Expect(largestDatastore(ctx, vc, "datacenter-2")).To(Equal("/dc0/datastore/ds1"))
+		Expect(vc.Calls()).To(Equal([]string{"GetDatastores", "GetDatastoreCapacities"}))
+	})
+})
+
+var _ = Describe("Default vSphere inventory", func() {
+	It("should be created once", func() {
+		ctx := context.Background()
+		r := &VSphereInventoryReconciler{Client: k8sClient, DefaultInventory: "vsphere-" + rand.String(5)}
+		Expect(r.createDefaultInventory(ctx)).To(Succeed())
+
+		inventory := &imagebuilderv1alpha1.VSphereInventory{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: r.DefaultInventory}, inventory)).To(Succeed())
+		DeferCleanup(func() {
+			Expect(k8sClient.Delete(ctx, inventory)).To(Succeed())
+		})
+
+		// The existing inventory is left as is on the next start.
+		Expect(r.createDefaultInventory(ctx)).To(Succeed())
+	})
+
+	It("should retry the transient errors until it is created", func() {
+		backoff := defaultInventoryBackoff
+		defaultInventoryBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 1}
+		DeferCleanup(func() { defaultInventoryBackoff = backoff })
+
+		ctx := context.Background()
+		scheme := runtime.NewScheme()
+		Expect(imagebuilderv1alpha1.AddToScheme(scheme)).To(Succeed())
+		c := &failingCreateClient{Client: clientfake.NewClientBuilder().WithScheme(scheme).Build(), failures: 2}
+		r := &VSphereInventoryReconciler{Client: c, DefaultInventory: "vsphere"}
+		Expect(r.ensureDefaultInventory(ctx)).To(Succeed())
+		Expect(c.failures).To(BeZero())
+		Expect(c.Get(ctx, client.ObjectKey{Name: "vsphere"}, &imagebuilderv1alpha1.VSphereInventory{})).To(Succeed())
+	})
+
+	It("should stop retrying with the manager", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := &failingCreateClient{failures: 1}
+		r := &VSphereInventoryReconciler{Client: c, DefaultInventory: "vsphere"}
+		Expect(r.ensureDefaultInventory(ctx)).To(Succeed())
+	})
+})
+
+// failingDatacenterClient fails the network list of a datacenter
+type failingDatacenterClient struct {
+	*fake.Client
+	moid string
+}
+
+func (c *failingDatacenterClient) GetNetworks(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	if datacenterMOID == c.moid {
+		return nil, fmt.Errorf("permission denied")
+	}
+	return c.Client.GetNetworks(ctx, datacenterMOID)
+}
+
+// failingCreateClient fails the first creations like an API server not ready yet
+type failingCreateClient struct {
+	client.Client
+	failures int
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if c.failures > 0 {
+		c.failures--
+		return apierrors.NewServiceUnavailable("webhook not ready")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
@@ -19,20 +19,24 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	imagebuilderv1alpha1 "github.com/knabben/tkw/api/v1alpha1"
 	"github.com/knabben/tkw/controllers"
+	"github.com/knabben/tkw/pkg/vsphere"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -52,11 +56,28 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var buildNamespace string
+	var credentialsSecret string
+	var timeouts vsphere.Timeouts
+	var templateResyncInterval time.Duration
+	var watchTemplates bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&buildNamespace, "build-namespace", "tkw-system",
+		"The namespace hosting the OSImage build resources, config/default grants the Secret permissions in it.")
+	flag.StringVar(&credentialsSecret, "credentials-secret", "",
+		"The namespace/name of the Secret with the default vSphere credentials, defaults to the vsphere-cloud-config credentials.")
+	flag.DurationVar(&timeouts.API, "vsphere-api-timeout", vsphere.DefaultTimeouts.API,
+		"The timeout of each vCenter API call, 0 disables it.")
+	flag.DurationVar(&timeouts.Task, "vsphere-task-timeout", vsphere.DefaultTimeouts.Task,
+		"The timeout of the vCenter tasks like datastore searches, 0 disables it.")
+	flag.DurationVar(&templateResyncInterval, "template-resync-interval", controllers.DefaultTemplateResyncInterval,
+		"The period between two listings of the OSImage vSphere templates, 0 disables it.")
+	flag.BoolVar(&watchTemplates, "watch-templates", true,
+		"Reconcile the OSImages as soon as a template changes in the datacenters of the default vSphere credentials.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,6 +86,12 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// The build Secrets RBAC is scoped to a namespace, the OSImage namespaces are not allowed.
+	if buildNamespace == "" {
+		setupLog.Error(nil, "the build namespace can not be empty", "build-namespace", buildNamespace)
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -78,13 +105,76 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Secrets are read with the API reader, a cached client would list and watch all of them.
+	credentials := &controllers.Credentials{
+		Reader:       mgr.GetClient(),
+		SecretReader: mgr.GetAPIReader(),
+	}
+	if credentialsSecret != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(credentialsSecret)
+		if err != nil || namespace == "" || name == "" {
+			setupLog.Error(err, "invalid credentials secret, use namespace/name", "credentials-secret", credentialsSecret)
+			os.Exit(1)
+		}
+		credentials.DefaultSecret = &types.NamespacedName{Namespace: namespace, Name: name}
+	}
+
+	// The windows.json ConfigMap of previous versions holds the vCenter credentials.
+	if err := mgr.Add(&controllers.LegacyCleanup{Client: mgr.GetClient()}); err != nil {
+		setupLog.Error(err, "unable to add the legacy resources cleanup")
+		os.Exit(1)
+	}
+
+	// vCenter sessions are shared by the controllers and logged out on shutdown.
+	sessions := vsphere.NewSessions(timeouts)
+	if err := mgr.Add(sessions); err != nil {
+		setupLog.Error(err, "unable to add the vCenter sessions")
+		os.Exit(1)
+	}
+
+	// Template changes are pushed by a vCenter property collector subscription.
+	var templateWatcher *controllers.TemplateWatcher
+	if watchTemplates {
+		templateWatcher = controllers.NewTemplateWatcher(mgr.GetClient(), credentials, sessions)
+		if err := mgr.Add(templateWatcher); err != nil {
+			setupLog.Error(err, "unable to add the vCenter template watcher")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.OSImageReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Credentials:    credentials,
+		VSphereClients: sessions,
+		APIReader:      mgr.GetAPIReader(),
+		Recorder:       mgr.GetEventRecorderFor("osimage-controller"),
+		BuildNamespace: buildNamespace,
+
+		TemplateResyncInterval: templateResyncInterval,
+		TemplateWatcher:        templateWatcher,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "OSImage")
 		os.Exit(1)
 	}
+	if err = (&controllers.VSphereInventoryReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		Credentials:      credentials,
+		VSphereClients:   sessions,
+		DefaultInventory: controllers.DefaultInventoryName,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VSphereInventory")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&controllers.OSImageValidator{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "OSImage")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
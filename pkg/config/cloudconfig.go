@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultVirtualCenterPort is the vCenter port when the configuration sets none
+const DefaultVirtualCenterPort = "443"
+
+// VirtualCenterConfig holds the settings of a vCenter, the Global section holds the
+// defaults of the VirtualCenter sections.
+type VirtualCenterConfig struct {
+	Server           string
+	Port             string
+	User             string
+	Password         string
+	InsecureFlag     bool
+	Datacenters      []string
+	SecretName       string
+	SecretNamespace  string
+	SecretsDirectory string
+	CAFile           string
+	Thumbprint       string
+}
+
+// Address returns the vCenter host, with the port when it is not the default one
+func (v *VirtualCenterConfig) Address() string {
+	if v.Port == "" || v.Port == DefaultVirtualCenterPort {
+		return v.Server
+	}
+	return fmt.Sprintf("%s:%s", v.Server, v.Port)
+}
+
+// Datacenter returns the first datacenter of the vCenter
+func (v *VirtualCenterConfig) Datacenter() string {
+	if len(v.Datacenters) == 0 {
+		return ""
+	}
+	return v.Datacenters[0]
+}
+
+// CloudConfig is the vsphere.conf of cloud-provider-vsphere
+type CloudConfig struct {
+	Global VirtualCenterConfig
+
+	// VirtualCenters are in file order, the unset settings are inherited from Global.
+	VirtualCenters []VirtualCenterConfig
+}
+
+// VirtualCenter returns the vCenter of the server, or the first one when it is empty
+func (c *CloudConfig) VirtualCenter(server string) (*VirtualCenterConfig, error) {
+	if len(c.VirtualCenters) == 0 {
+		return nil, fmt.Errorf("no vCenter in vsphere.conf")
+	}
+	if server == "" {
+		return &c.VirtualCenters[0], nil
+	}
+	var servers []string
+	for i := range c.VirtualCenters {
+		if c.VirtualCenters[i].Server == server {
+			return &c.VirtualCenters[i], nil
+		}
+		servers = append(servers, c.VirtualCenters[i].Server)
+	}
+	return nil, fmt.Errorf("vCenter %s is not in vsphere.conf, available: %s", server, strings.Join(servers, ", "))
+}
+
+// settings are the key values of a section, keys are normalized so the INI
+// "secret-name" and the YAML "secretName" are the same setting.
+type settings map[string]string
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(strings.TrimSpace(key)))
+}
+
+// section is a VirtualCenter section, named after the server in INI and the tenant in YAML
+type section struct {
+	name     string
+	settings settings
+}
+
+// ParseCloudConfig parses the INI or YAML vsphere.conf of cloud-provider-vsphere,
+// the format is detected from the first statement.
+func ParseCloudConfig(data string) (*CloudConfig, error) {
+	var (
+		global   settings
+		sections []section
+		err      error
+	)
+	if isINI(data) {
+		global, sections, err = parseINI(data)
+	} else {
+		global, sections, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &CloudConfig{}
+	if cfg.Global, err = global.virtualCenter(); err != nil {
+		return nil, fmt.Errorf("global: %v", err)
+	}
+
+	// A single vCenter can be set in the global section.
+	if len(sections) == 0 && cfg.Global.Server != "" {
+		sections = append(sections, section{name: cfg.Global.Server})
+	}
+	for _, s := range sections {
+		merged := settings{}
+		for k, v := range global {
+			merged[k] = v
+		}
+		merged["server"] = ""
+		for k, v := range s.settings {
+			merged[k] = v
+		}
+		if merged["server"] == "" {
+			merged["server"] = s.name
+		}
+		vc, err := merged.virtualCenter()
+		if err != nil {
+			return nil, fmt.Errorf("vCenter %s: %v", s.name, err)
+		}
+		cfg.VirtualCenters = append(cfg.VirtualCenters, vc)
+	}
+	return cfg, nil
+}
+
+// virtualCenter returns the typed settings
+func (s settings) virtualCenter() (VirtualCenterConfig, error) {
+	vc := VirtualCenterConfig{
+		Server:           s["server"],
+		Port:             s["port"],
+		User:             s["user"],
+		Password:         s["password"],
+		SecretName:       s["secretname"],
+		SecretNamespace:  s["secretnamespace"],
+		SecretsDirectory: s["secretsdirectory"],
+		CAFile:           s["cafile"],
+		Thumbprint:       s["thumbprint"],
+	}
+	for _, dc := range strings.Split(s["datacenters"], ",") {
+		if dc = strings.TrimSpace(dc); dc != "" {
+			vc.Datacenters = append(vc.Datacenters, dc)
+		}
+	}
+	if vc.Port != "" {
+		if _, err := strconv.ParseUint(vc.Port, 10, 16); err != nil {
+			return vc, fmt.Errorf("invalid port %q", vc.Port)
+		}
+	}
+	if flag := s["insecureflag"]; flag != "" {
+		insecure, err := strconv.ParseBool(flag)
+		if err != nil {
+			return vc, fmt.Errorf("invalid insecure-flag %q", flag)
+		}
+		vc.InsecureFlag = insecure
+	}
+	return vc, nil
+}
+
+// isINI returns true when the first statement is an INI section header
+func isINI(data string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		return strings.HasPrefix(line, "[")
+	}
+	return false
+}
+
+// parseINI parses the gcfg format, `[Global]` and `[VirtualCenter "server"]` sections
+// with `key = value` settings. Values can be quoted, unquoted ones end at a comment.
+func parseINI(data string) (settings, []section, error) {
+	var (
+		global   = settings{}
+		sections []section
+		current  settings
+	)
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				return nil, nil, fmt.Errorf("line %d: unterminated section %q", n, line)
+			}
+			name, subsection := splitSection(line[1:end])
+			switch strings.ToLower(name) {
+			case "global":
+				current = global
+			case "virtualcenter":
+				if subsection == "" {
+					return nil, nil, fmt.Errorf("line %d: VirtualCenter section without server", n)
+				}
+				sections = append(sections, section{name: subsection, settings: settings{}})
+				current = sections[len(sections)-1].settings
+			default:
+				// Workspace, Labels and the other sections are not used.
+				current = nil
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: expected key = value, got %q", n, line)
+		}
+		if current == nil {
+			continue
+		}
+		unquoted, err := iniValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		current[normalizeKey(key)] = unquoted
+	}
+	return global, sections, scanner.Err()
+}
+
+// splitSection splits `VirtualCenter "server"` in its name and subsection
+func splitSection(header string) (string, string) {
+	name, subsection, _ := strings.Cut(strings.TrimSpace(header), " ")
+	return name, strings.Trim(strings.TrimSpace(subsection), `"`)
+}
+
+// iniValue returns the value without quotes and trailing comment
+func iniValue(value string) (string, error) {
+	if strings.HasPrefix(value, `"`) {
+		end := closingQuote(value)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.ContainsAny(rest[:1], "#;") {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		unquoted, err := strconv.Unquote(value[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", value)
+		}
+		return unquoted, nil
+	}
+	if i := strings.IndexAny(value, "#;"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the quote closing the value opened at index 0,
+// the escaped quotes are skipped. It is -1 when the value is not terminated.
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAML parses the `global` and `vcenter` keys of the YAML format, the
+// vcenter tenants keep the file order.
+func parseYAML(data string) (settings, []section, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		global   = settings{}
+		sections []section
+	)
+	for _, item := range doc {
+		switch normalizeKey(fmt.Sprint(item.Key)) {
+		case "global":
+			values, err := yamlSettings(item.Value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("global: %v", err)
+			}
+			global = values
+		case "vcenter":
+			tenants, ok := item.Value.(yaml.MapSlice)
+			if !ok && item.Value != nil {
+				return nil, nil, fmt.Errorf("vcenter must be a map of tenants")
+			}
+			for _, tenant := range tenants {
+				values, err := yamlSettings(tenant.Value)
+				if err != nil {
+					return nil, nil, fmt.Errorf("vcenter %v: %v", tenant.Key, err)
+				}
+				sections = append(sections, section{name: fmt.Sprint(tenant.Key), settings: values})
+			}
+		}
+	}
+	return global, sections, nil
+}
+
+// yamlSettings flattens a YAML map, lists are joined like the INI datacenters
+func yamlSettings(value interface{}) (settings, error) {
+	values := settings{}
+	if value == nil {
+		return values, nil
+	}
+	items, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", value)
+	}
+	for _, item := range items {
+		switch v := item.Value.(type) {
+		case nil:
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, e := range v {
+				list = append(list, fmt.Sprint(e))
+			}
+			values[normalizeKey(fmt.Sprint(item.Key))] = strings.Join(list, ",")
+		case yaml.MapSlice:
+			return nil, fmt.Errorf("unexpected map in %v", item.Key)
+		default:
+			values[normalizeKey(fmt.Sprint(item.Key))] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,168 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/knabben/tkw/pkg/config"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestConfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Config Tests")
+}
+
+const iniConfig = `
+; cloud-provider-vsphere configuration
+[Global]
+	secret-name = "cloud-provider-vsphere-credentials"
+	secret-namespace = "kube-system"
+	insecure-flag = "1"
+	datacenters = "/dc0"
+[VirtualCenter "10.0.0.1"]
+	datacenters = "/dc0,/dc1"
+[VirtualCenter "vcenter-b.example.com"]
+	port = 8443
+	insecure-flag = false
+	thumbprint = "AA:BB:CC" ; SHA-1
+	secret-name = vcenter-b # per vCenter secret
+[Labels]
+	region = k8s-region
+`
+
+const yamlConfig = `
+global:
+  secretName: cloud-provider-vsphere-credentials
+  secretNamespace: kube-system
+  insecureFlag: true
+vcenter:
+  tenant-a:
+    server: 10.0.0.1
+    datacenters:
+      - /dc0
+      - /dc1
+  vcenter-b.example.com:
+    port: 8443
+    insecureFlag: false
+    thumbprint: "AA:BB:CC"
+    secretName: vcenter-b
+    datacenters: /dc2
+`
+
+var _ = Describe("vsphere.conf parsing", func() {
+	DescribeTable("parsing the vCenters",
+		func(data string, expected []config.VirtualCenterConfig) {
+			cfg, err := config.ParseCloudConfig(data)
+			Expect(err).To(BeNil())
+			Expect(cfg.VirtualCenters).To(Equal(expected))
+		},
+		Entry("INI with per vCenter settings", iniConfig, []config.VirtualCenterConfig{{
+			Server:          "10.0.0.1",
+			InsecureFlag:    true,
+			Datacenters:     []string{"/dc0", "/dc1"},
+			SecretName:      "cloud-provider-vsphere-credentials",
+			SecretNamespace: "kube-system",
+		}, {
+			Server:          "vcenter-b.example.com",
+			Port:            "8443",
+			Datacenters:     []string{"/dc0"},
+			SecretName:      "vcenter-b",
+			SecretNamespace: "kube-system",
+			Thumbprint:      "AA:BB:CC",
+		}}),
+		Entry("YAML with tenants", yamlConfig, []config.VirtualCenterConfig{{
+			Server:          "10.0.0.1",
+			InsecureFlag:    true,
+			Datacenters:     []string{"/dc0", "/dc1"},
+			SecretName:      "cloud-provider-vsphere-credentials",
+			SecretNamespace: "kube-system",
+		}, {
+			Server:          "vcenter-b.example.com",
+			Port:            "8443",
+			Datacenters:     []string{"/dc2"},
+			SecretName:      "vcenter-b",
+			SecretNamespace: "kube-system",
+			Thumbprint:      "AA:BB:CC",
+		}}),
+		Entry("INI with the vCenter in the global section", `
+[Global]
+user = "administrator@vsphere.local"
+password = "pass;word"
+server = 10.0.0.5
+datacenters = dc0
+`, []config.VirtualCenterConfig{{
+			Server:      "10.0.0.5",
+			User:        "administrator@vsphere.local",
+			Password:    "pass;word",
+			Datacenters: []string{"dc0"},
+		}}),
+		Entry("INI with unquoted values", `
+[VirtualCenter "10.0.0.1"]
+user = administrator@vsphere.local
+datacenters = dc0 , dc1
+`, []config.VirtualCenterConfig{{
+			Server:      "10.0.0.1",
+			User:        "administrator@vsphere.local",
+			Datacenters: []string{"dc0", "dc1"},
+		}}),
+		Entry("INI with quoted values and comments", `
+[VirtualCenter "10.0.0.1"]
+secret-name = "a" ; see "docs"
+secret-namespace = "kube-\"system\"" # escaped quotes
+`, []config.VirtualCenterConfig{{
+			Server:          "10.0.0.1",
+			SecretName:      "a",
+			SecretNamespace: `kube-"system"`,
+		}}),
+		Entry("YAML with the vCenter named by its tenant", `
+vcenter:
+  10.0.0.1:
+    user: administrator@vsphere.local
+`, []config.VirtualCenterConfig{{
+			Server: "10.0.0.1",
+			User:   "administrator@vsphere.local",
+		}}),
+	)
+
+	DescribeTable("rejecting invalid files",
+		func(data, message string) {
+			_, err := config.ParseCloudConfig(data)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("unterminated section", "[Global\nuser = a", "unterminated section"),
+		Entry("INI setting without value", "[Global]\nuser", "expected key = value"),
+		Entry("VirtualCenter without server", "[VirtualCenter]\nuser = a", "without server"),
+		Entry("unterminated quoted value", "[Global]\nuser = \"a ; b", "unterminated quoted value"),
+		Entry("text after the quoted value", "[Global]\nuser = \"a\" b", "invalid quoted value"),
+		Entry("invalid insecure flag", "[Global]\ninsecure-flag = maybe", "invalid insecure-flag"),
+		Entry("invalid port", "vcenter:\n  vc:\n    port: https", "invalid port"),
+		Entry("YAML vcenter list", "vcenter:\n  - 10.0.0.1", "map of tenants"),
+	)
+
+	Describe("selecting a vCenter", func() {
+		var cfg *config.CloudConfig
+
+		BeforeEach(func() {
+			var err error
+			cfg, err = config.ParseCloudConfig(iniConfig)
+			Expect(err).To(BeNil())
+		})
+
+		It("should default to the first vCenter", func() {
+			vc, err := cfg.VirtualCenter("")
+			Expect(err).To(BeNil())
+			Expect(vc.Address()).To(Equal("10.0.0.1"))
+			Expect(vc.Datacenter()).To(Equal("/dc0"))
+		})
+		It("should add the port to the address", func() {
+			vc, err := cfg.VirtualCenter("vcenter-b.example.com")
+			Expect(err).To(BeNil())
+			Expect(vc.Address()).To(Equal("vcenter-b.example.com:8443"))
+		})
+		It("should list the available vCenters", func() {
+			_, err := cfg.VirtualCenter("10.0.0.9")
+			Expect(err).To(MatchError(ContainSubstring("available: 10.0.0.1, vcenter-b.example.com")))
+		})
+	})
+})
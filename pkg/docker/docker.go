@@ -6,20 +6,32 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"github.com/knabben/tkw/pkg/windows"
 )
 
 type Docker struct {
 	WindowsFile string
-	Client      *client.Client
+	// MakeTarget is the image-builder target, ie build-node-ova-vsphere-windows-2022,
+	// the make target of windows.DefaultWindowsVersion when empty.
+	MakeTarget string
+	Client     *client.Client
 }
 
 const IMAGE_BUILDER = "projects.registry.vmware.com/tkg/image-builder:v0.1.12_vmware.2"
 
+// Command returns the image-builder container command
+func (d *Docker) Command() []string {
+	if d.MakeTarget == "" {
+		return []string{windows.DefaultMakeTarget()}
+	}
+	return []string{d.MakeTarget}
+}
+
 func (d *Docker) Run(ctx context.Context) (string, error) {
 	// Configuration with image-builder command and debugging flags.
 	config := container.Config{
 		Image: IMAGE_BUILDER,
-		Cmd:   []string{"build-node-ova-vsphere-windows-2019"},
+		Cmd:   d.Command(),
 		Env: []string{
 			"PACKER_LOG=1",
 			"PACKER_VAR_FILES=windows.json",
@@ -0,0 +1,27 @@
+package docker_test
+
+import (
+	"testing"
+
+	"github.com/knabben/tkw/pkg/docker"
+	"github.com/knabben/tkw/pkg/windows"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestDocker(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Docker Tests")
+}
+
+var _ = Describe("Image builder container", func() {
+	It("should build the default Windows version without make target", func() {
+		d := &docker.Docker{}
+		Expect(d.Command()).To(Equal([]string{"build-node-ova-vsphere-windows-" + windows.DefaultWindowsVersion}))
+	})
+
+	It("should run the make target", func() {
+		d := &docker.Docker{MakeTarget: "build-node-ova-vsphere-windows-2022"}
+		Expect(d.Command()).To(Equal([]string{"build-node-ova-vsphere-windows-2022"}))
+	})
+})
@@ -28,35 +28,48 @@ const (
 	VspherePassword   = "VSPHERE_PASSWORD"
 	VsphereServer     = "VSPHERE_SERVER"
 	VsphereDataCenter = "VSPHERE_DATACENTER"
+	VsphereThumbprint = "VSPHERE_TLS_THUMBPRINT"
+	VsphereCABundle   = "VSPHERE_TLS_CA_BUNDLE"
+	VsphereInsecure   = "VSPHERE_INSECURE"
 )
 
 // DefaultClient dafaults vc client
 type DefaultClient struct {
 	vmomiClient *govmomi.Client
 	restClient  *rest.Client
+	timeouts    Timeouts
+
+	// relogin logs in again the SOAP calls rejected once the session expired
+	relogin *reloginRoundTripper
 }
 
-// NewClient returns a new VC Client
-func NewClient(vcURL *url.URL, thumbprint string, insecure bool) (Client, error) {
-	vmomiClient, err := newGovmomiClient(vcURL, thumbprint, insecure)
+// NewClient returns a new VC Client, each method call is bounded by the API timeout
+func NewClient(ctx context.Context, vcURL *url.URL, tlsConfig TLSConfig, timeouts Timeouts) (Client, error) {
+	ctx, cancel := withTimeout(ctx, timeouts.API)
+	defer cancel()
+
+	vmomiClient, err := newGovmomiClient(ctx, vcURL, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
 	restClient := rest.NewClient(vmomiClient.Client)
+	relogin := &reloginRoundTripper{RoundTripper: vmomiClient.Client.RoundTripper}
+	vmomiClient.Client.RoundTripper = relogin
 	return &DefaultClient{
 		vmomiClient: vmomiClient,
 		restClient:  restClient,
+		timeouts:    timeouts,
+		relogin:     relogin,
 	}, nil
 }
 
-func newGovmomiClient(vcURL *url.URL, thumbprint string, insecure bool) (*govmomi.Client, error) {
-	ctx := context.Background()
+func newGovmomiClient(ctx context.Context, vcURL *url.URL, tlsConfig TLSConfig) (*govmomi.Client, error) {
 	var vmomiClient *govmomi.Client
 	var err error
 
-	soapClient := soap.NewClient(vcURL, insecure)
-	if !insecure && thumbprint != "" {
-		soapClient.SetThumbprint(vcURL.Host, thumbprint)
+	soapClient := soap.NewClient(vcURL, tlsConfig.Insecure)
+	if err := tlsConfig.configure(soapClient, vcURL.Host); err != nil {
+		return nil, err
 	}
 	vimClient, err := vim25.NewClient(ctx, soapClient)
 	if err != nil {
@@ -79,6 +92,8 @@ func newGovmomiClient(vcURL *url.URL, thumbprint string, insecure bool) (*govmom
 
 // Login authenticates with vCenter using user/password
 func (c *DefaultClient) Login(ctx context.Context, user, password string) (string, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 	var err error
 	var token string
 
@@ -100,16 +115,23 @@ func (c *DefaultClient) Login(ctx context.Context, user, password string) (strin
 		return "", errors.Wrap(err, "cannot login to vc")
 	}
 
-	token, err = c.AcquireTicket()
+	if c.relogin != nil {
+		c.relogin.setLogin(func(ctx context.Context) error {
+			return client.Login(ctx, userInfo)
+		})
+	}
+
+	token, err = c.AcquireTicket(ctx)
 	return token, err
 }
 
 // AcquireTicket acquires a new session ticket for the user associated with
 // the authenticated client.
-func (c *DefaultClient) AcquireTicket() (string, error) {
+func (c *DefaultClient) AcquireTicket(ctx context.Context) (string, error) {
 	var err error
 	var token string
-	ctx := context.Background()
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 
 	client := c.vmomiClient
 	if client == nil {
@@ -123,9 +145,40 @@ func (c *DefaultClient) AcquireTicket() (string, error) {
 	return token, nil
 }
 
+// Logout ends the SOAP and REST sessions
+func (c *DefaultClient) Logout(ctx context.Context) error {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	if c.vmomiClient == nil {
+		return fmt.Errorf("uninitialized vmomi client")
+	}
+	if c.relogin != nil {
+		c.relogin.setLogin(nil)
+	}
+	var errs []string
+	if c.restClient != nil {
+		if err := c.restClient.Logout(ctx); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := c.vmomiClient.Logout(ctx); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot logout from vc: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// apiContext returns the context of a method call bounded by the API timeout
+func (c *DefaultClient) apiContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return c.timeouts.APIContext(ctx)
+}
+
 // CheckUserSessionActive checks if a user session is Active
-func (c *DefaultClient) CheckUserSessionActive() (bool, error) {
-	ctx := context.Background()
+func (c *DefaultClient) CheckUserSessionActive(ctx context.Context) (bool, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 
 	client := c.vmomiClient
 	if client == nil {
@@ -136,6 +189,8 @@ func (c *DefaultClient) CheckUserSessionActive() (bool, error) {
 
 // GetDatacenters returns a list of all datacenters in the vSphere inventory.
 func (c *DefaultClient) GetDatacenters(ctx context.Context) ([]*models.VSphereDatacenter, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 	if c.vmomiClient == nil {
 		return nil, fmt.Errorf("uninitialized vmomi client")
 	}
@@ -144,6 +199,9 @@ func (c *DefaultClient) GetDatacenters(ctx context.Context) ([]*models.VSphereDa
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating datacenter view")
 	}
+	defer func() {
+		_ = v.Destroy(ctx)
+	}()
 
 	var dcs []mo.Datacenter
 	err = v.Retrieve(ctx, viewTypes, []string{"name"}, &dcs)
@@ -170,9 +228,18 @@ func (c *DefaultClient) GetDatacenters(ctx context.Context) ([]*models.VSphereDa
 
 // GetPath takes in the MOID of a vsphere resource and returns a fully qualified path
 func (c *DefaultClient) GetPath(ctx context.Context, moid string) (string, []*models.VSphereManagementObject, error) {
+	return c.getPath(ctx, types.ManagedObjectReference{Value: moid})
+}
+
+// getPath returns the fully qualified path of the referenced resource, the type
+// of the parents is read from their references and only guessed from the MOID
+// when the reference has none.
+func (c *DefaultClient) getPath(ctx context.Context, ref types.ManagedObjectReference) (string, []*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 	client := c.vmomiClient
 	var objects []*models.VSphereManagementObject
-	if moid == "" {
+	if ref.Value == "" {
 		return "", objects, errors.New("a non-empty moid should be passed to GetPath")
 	}
 	if client == nil {
@@ -181,7 +248,7 @@ func (c *DefaultClient) GetPath(ctx context.Context, moid string) (string, []*mo
 	path := []string{}
 	defaultFolder := ""
 	for {
-		ref, commonProps, resourceType, err := c.populateGoVCVars(moid)
+		commonProps, resourceType, err := c.populateGoVCVars(&ref)
 		if err != nil {
 			break
 		}
@@ -200,19 +267,20 @@ func (c *DefaultClient) GetPath(ctx context.Context, moid string) (string, []*mo
 			break
 		}
 
-		if isFolder(moid) && isDatacenter(managedEntity.Parent.Reference().Value) {
-			defaultFolder = moid
-		} else if !isDatacenter(moid) {
+		parent := managedEntity.Parent.Reference()
+		if ref.Type == TypeFolder && parent.Type == TypeDatacenter {
+			defaultFolder = ref.Value
+		} else if ref.Type != TypeDatacenter {
 			obj := &models.VSphereManagementObject{
 				Name:         name,
 				Moid:         ref.Value,
-				ParentMoid:   managedEntity.Parent.Reference().Value,
+				ParentMoid:   parent.Value,
 				ResourceType: resourceType,
 			}
 
 			objects = append(objects, obj)
 		}
-		moid = managedEntity.Parent.Reference().Value
+		ref = parent
 	}
 
 	objects = c.unsetDefaultFolder(objects, defaultFolder)
@@ -227,52 +295,80 @@ func (c *DefaultClient) GetPath(ctx context.Context, moid string) (string, []*mo
 	return res, objects, nil
 }
 
-func (c *DefaultClient) populateGoVCVars(moid string) (ref types.ManagedObjectReference, commonProps object.Common, resourceType string, err error) {
-	switch {
-	case isResourcePool(moid):
-		ref = types.ManagedObjectReference{Type: TypeResourcePool, Value: moid}
-		commonProps = object.NewResourcePool(c.vmomiClient.Client, ref).Common
+// populateGoVCVars returns the object and resource type of the reference, setting
+// its type from the MOID when missing.
+func (c *DefaultClient) populateGoVCVars(ref *types.ManagedObjectReference) (commonProps object.Common, resourceType string, err error) {
+	if ref.Type == "" {
+		ref.Type = moidType(ref.Value)
+	}
+	switch ref.Type {
+	case TypeResourcePool:
+		commonProps = object.NewResourcePool(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeRespool
-	case isClusterComputeResource(moid):
-		ref = types.ManagedObjectReference{Type: TypeCluster, Value: moid}
-		commonProps = object.NewClusterComputeResource(c.vmomiClient.Client, ref).Common
+	case TypeCluster:
+		commonProps = object.NewClusterComputeResource(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeCluster
-	case isHostComputeResource(moid):
-		ref = types.ManagedObjectReference{Type: TypeComputeResource, Value: moid}
-		commonProps = object.NewComputeResource(c.vmomiClient.Client, ref).Common
+	case TypeComputeResource:
+		commonProps = object.NewComputeResource(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeHost
-	case isDatastore(moid):
-		ref = types.ManagedObjectReference{Type: TypeDatastore, Value: moid}
-		commonProps = object.NewDatastore(c.vmomiClient.Client, ref).Common
+	case TypeHostSystem:
+		commonProps = object.NewHostSystem(c.vmomiClient.Client, *ref).Common
+		resourceType = models.VSphereManagementObjectResourceTypeHost
+	case TypeDatastore:
+		commonProps = object.NewDatastore(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeDatastore
-	case isFolder(moid):
-		ref = types.ManagedObjectReference{Type: TypeFolder, Value: moid}
-		commonProps = object.NewFolder(c.vmomiClient.Client, ref).Common
+	case TypeFolder:
+		commonProps = object.NewFolder(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeFolder
-	case isVirtualMachine(moid):
-		ref = types.ManagedObjectReference{Type: TypeVirtualMachine, Value: moid}
-		commonProps = object.NewVirtualMachine(c.vmomiClient.Client, ref).Common
+	case TypeVirtualMachine:
+		commonProps = object.NewVirtualMachine(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeVM
-	case isDatacenter(moid):
-		ref = types.ManagedObjectReference{Type: TypeDatacenter, Value: moid}
-		commonProps = object.NewDatacenter(c.vmomiClient.Client, ref).Common
+	case TypeDatacenter:
+		commonProps = object.NewDatacenter(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeDatacenter
-	case isNetwork(moid):
-		ref = types.ManagedObjectReference{Type: TypeNetwork, Value: moid}
-		commonProps = object.NewNetwork(c.vmomiClient.Client, ref).Common
+	case TypeNetwork:
+		commonProps = object.NewNetwork(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeNetwork
-	case isDvPortGroup(moid):
-		ref = types.ManagedObjectReference{Type: TypeDvpg, Value: moid}
-		commonProps = object.NewDistributedVirtualPortgroup(c.vmomiClient.Client, ref).Common
+	case TypeDvpg:
+		commonProps = object.NewDistributedVirtualPortgroup(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeNetwork
-	case isDvs(moid):
-		ref = types.ManagedObjectReference{Type: TypeDvs, Value: moid}
-		commonProps = object.NewDistributedVirtualSwitch(c.vmomiClient.Client, ref).Common
+	case TypeDvs:
+		commonProps = object.NewDistributedVirtualSwitch(c.vmomiClient.Client, *ref).Common
 		resourceType = models.VSphereManagementObjectResourceTypeNetwork
 	default:
 		err = errors.New("moid value not recognized")
 	}
-	return ref, commonProps, resourceType, err
+	return commonProps, resourceType, err
+}
+
+// moidType returns the managed object type guessed from the MOID prefix, empty
+// when not recognized.
+func moidType(moid string) string {
+	switch {
+	case isResourcePool(moid):
+		return TypeResourcePool
+	case isClusterComputeResource(moid):
+		return TypeCluster
+	case isHostComputeResource(moid):
+		return TypeComputeResource
+	case isHostSystem(moid):
+		return TypeHostSystem
+	case isDatastore(moid):
+		return TypeDatastore
+	case isFolder(moid):
+		return TypeFolder
+	case isVirtualMachine(moid):
+		return TypeVirtualMachine
+	case isDatacenter(moid):
+		return TypeDatacenter
+	case isNetwork(moid):
+		return TypeNetwork
+	case isDvPortGroup(moid):
+		return TypeDvpg
+	case isDvs(moid):
+		return TypeDvs
+	}
+	return ""
 }
 
 func (c *DefaultClient) unsetDefaultFolder(objects []*models.VSphereManagementObject, defaultFolder string) []*models.VSphereManagementObject {
@@ -296,10 +392,13 @@ func (c *DefaultClient) getVirtualMachines(ctx context.Context, datacenterMOID s
 
 	dcRef := TypeDatacenter + ":" + datacenterMOID
 
-	view, err := c.createContainerView(context.Background(), dcRef, viewTypes)
+	view, err := c.createContainerView(ctx, dcRef, viewTypes)
 	if err != nil {
 		return vms, errors.Wrap(err, "error creating container view")
 	}
+	defer func() {
+		_ = view.Destroy(ctx)
+	}()
 
 	err = view.Retrieve(ctx, viewTypes, []string{"name", "config"}, &vms)
 	if err != nil {
@@ -311,6 +410,8 @@ func (c *DefaultClient) getVirtualMachines(ctx context.Context, datacenterMOID s
 
 // GetVirtualMachines gets vms under given datacenter
 func (c *DefaultClient) GetVirtualMachines(ctx context.Context, datacenterMOID string) ([]*models.VSphereVirtualMachine, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 	results := []*models.VSphereVirtualMachine{}
 
 	vms, err := c.getVirtualMachines(ctx, datacenterMOID)
@@ -319,7 +420,7 @@ func (c *DefaultClient) GetVirtualMachines(ctx context.Context, datacenterMOID s
 	}
 
 	for i := range vms {
-		path, _, err := c.GetPath(ctx, vms[i].Self.Value)
+		path, _, err := c.getPath(ctx, vms[i].Self)
 		if err != nil {
 			continue
 		}
@@ -331,6 +432,8 @@ func (c *DefaultClient) GetVirtualMachines(ctx context.Context, datacenterMOID s
 
 // GetImportedVirtualMachinesImages gets imported virtual machine images used for tkg
 func (c *DefaultClient) GetImportedVirtualMachinesImages(ctx context.Context, datacenterMOID string) ([]mo.VirtualMachine, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
 	if c.vmomiClient == nil {
 		return nil, fmt.Errorf("uninitialized vmomi client")
 	}
@@ -341,10 +444,13 @@ func (c *DefaultClient) GetImportedVirtualMachinesImages(ctx context.Context, da
 
 	dcRef := TypeDatacenter + ":" + datacenterMOID
 
-	view, err := c.createContainerView(context.Background(), dcRef, viewTypes)
+	view, err := c.createContainerView(ctx, dcRef, viewTypes)
 	if err != nil {
 		return vms, errors.Wrap(err, "error creating container view")
 	}
+	defer func() {
+		_ = view.Destroy(ctx)
+	}()
 
 	filter := property.Filter{}
 	filter["runtime.powerState"] = types.VirtualMachinePowerStatePoweredOff
@@ -361,7 +467,7 @@ func (c *DefaultClient) GetImportedVirtualMachinesImages(ctx context.Context, da
 	}
 	pc := property.DefaultCollector(c.vmomiClient.Client)
 
-	err = pc.Retrieve(ctx, objs, []string{"name", "config", "runtime.powerState"}, &vms)
+	err = pc.Retrieve(ctx, objs, []string{"name", "parent", "config", "runtime.powerState"}, &vms)
 	if err != nil {
 		return vms, err
 	}
@@ -393,7 +499,14 @@ func (c *DefaultClient) GetImportedVirtualMachinesImages(ctx context.Context, da
 	return results, nil
 }
 
+// GetVMMetadata returns the vApp properties of the virtual machine
 func (c *DefaultClient) GetVMMetadata(vm *mo.VirtualMachine) (properties map[string]string) {
+	return VMMetadata(vm)
+}
+
+// VMMetadata returns the vApp property values of the virtual machine by ID, nil
+// without vApp configuration.
+func VMMetadata(vm *mo.VirtualMachine) (properties map[string]string) {
 	if vm.Config == nil {
 		return
 	}
@@ -430,6 +543,10 @@ func isHostComputeResource(moID string) bool {
 	return strings.HasPrefix(moID, "domain-s")
 }
 
+func isHostSystem(moID string) bool {
+	return strings.HasPrefix(moID, "host-")
+}
+
 func isDatacenter(moID string) bool {
 	return strings.HasPrefix(moID, "datacenter-")
 }
@@ -0,0 +1,454 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+var _ = Describe("vCenter client", func() {
+	var (
+		ctx    = context.Background()
+		client *DefaultClient
+		finder *find.Finder
+		dc     *object.Datacenter
+	)
+
+	BeforeEach(func() {
+		vc, err := ConnectVCLogin(ctx, vcServer, username, password, trust, DefaultTimeouts)
+		Expect(err).To(BeNil())
+		client = vc.(*DefaultClient)
+
+		finder = find.NewFinder(client.vmomiClient.Client)
+		dc, err = finder.Datacenter(ctx, "DC0")
+		Expect(err).To(BeNil())
+		finder.SetDatacenter(dc)
+
+		// Registered first, the logout runs after the cleanups of the specs.
+		DeferCleanup(func() {
+			Expect(client.Logout(ctx)).To(Succeed())
+		})
+	})
+
+	// createVM creates a powered off virtual machine on the standalone host
+	createVM := func(name string, extraConfig []types.BaseOptionValue, vApp types.BaseVmConfigSpec) *object.VirtualMachine {
+		folders, err := dc.Folders(ctx)
+		Expect(err).To(BeNil())
+		pool, err := finder.ResourcePool(ctx, "/DC0/host/DC0_H0/Resources")
+		Expect(err).To(BeNil())
+
+		task, err := folders.VmFolder.CreateVM(ctx, types.VirtualMachineConfigSpec{
+			Name:        name,
+			GuestId:     string(types.VirtualMachineGuestOsIdentifierOtherGuest),
+			Files:       &types.VirtualMachineFileInfo{VmPathName: "[LocalDS_0]"},
+			ExtraConfig: extraConfig,
+			VAppConfig:  vApp,
+		}, pool, nil)
+		Expect(err).To(BeNil())
+		info, err := task.WaitForResult(ctx, nil)
+		Expect(err).To(BeNil())
+
+		vm := object.NewVirtualMachine(client.vmomiClient.Client, info.Result.(types.ManagedObjectReference))
+		if vApp != nil {
+			task, err := vm.Reconfigure(ctx, types.VirtualMachineConfigSpec{VAppConfig: vApp})
+			Expect(err).To(BeNil())
+			Expect(task.Wait(ctx)).To(Succeed())
+		}
+		DeferCleanup(func() {
+			state, err := vm.PowerState(ctx)
+			if soap.IsSoapFault(err) {
+				// The spec destroyed the virtual machine.
+				if _, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound); ok {
+					return
+				}
+			}
+			if err == nil && state == types.VirtualMachinePowerStatePoweredOn {
+				task, err := vm.PowerOff(ctx)
+				Expect(err).To(BeNil())
+				Expect(task.Wait(ctx)).To(Succeed())
+			}
+			task, err := vm.Destroy(ctx)
+			Expect(err).To(BeNil())
+			Expect(task.Wait(ctx)).To(Succeed())
+		})
+		return vm
+	}
+
+	It("should list the datacenters by path", func() {
+		datacenters, err := client.GetDatacenters(ctx)
+		Expect(err).To(BeNil())
+		Expect(datacenters).To(ContainElement(&models.VSphereDatacenter{Moid: dc.Reference().Value, Name: "/DC0"}))
+	})
+
+	// vcsim MOIDs do not follow the vCenter prefixes, standalone compute resources
+	// are computeresource-N instead of domain-sN, the references carry their type.
+	DescribeTable("resolving the path of a reference",
+		func(inventoryPath, resourceType string) {
+			ref, err := object.NewSearchIndex(client.vmomiClient.Client).FindByInventoryPath(ctx, inventoryPath)
+			Expect(err).To(BeNil())
+			Expect(ref).NotTo(BeNil())
+
+			path, objects, err := client.getPath(ctx, ref.Reference())
+			Expect(err).To(BeNil())
+			Expect(path).To(Equal(inventoryPath))
+			if resourceType == "" {
+				Expect(objects).To(BeEmpty())
+				return
+			}
+			Expect(objects).NotTo(BeEmpty())
+			Expect(objects[0].Moid).To(Equal(ref.Reference().Value))
+			Expect(objects[0].Name).To(Equal(inventoryPath[strings.LastIndex(inventoryPath, "/")+1:]))
+			Expect(objects[0].ResourceType).To(Equal(resourceType))
+		},
+		Entry("datacenter", "/DC0", ""),
+		Entry("datacenter folder", "/DC0/vm", ""),
+		Entry("cluster", "/DC0/host/DC0_C0", models.VSphereManagementObjectResourceTypeCluster),
+		Entry("standalone compute resource", "/DC0/host/DC0_H0", models.VSphereManagementObjectResourceTypeHost),
+		Entry("host", "/DC0/host/DC0_C0/DC0_C0_H0", models.VSphereManagementObjectResourceTypeHost),
+		Entry("standalone host", "/DC0/host/DC0_H0/DC0_H0", models.VSphereManagementObjectResourceTypeHost),
+		Entry("resource pool", "/DC0/host/DC0_C0/Resources", models.VSphereManagementObjectResourceTypeRespool),
+		Entry("datastore", "/DC0/datastore/LocalDS_0", models.VSphereManagementObjectResourceTypeDatastore),
+		Entry("virtual machine", "/DC0/vm/DC0_H0_VM0", models.VSphereManagementObjectResourceTypeVM),
+		Entry("network", "/DC0/network/VM Network", models.VSphereManagementObjectResourceTypeNetwork),
+		Entry("distributed port group", "/DC0/network/DC0_DVPG0", models.VSphereManagementObjectResourceTypeNetwork),
+		// vcsim registers the switches as DistributedVirtualSwitch while vCenter and the
+		// client use the VmwareDistributedVirtualSwitch type, switches are not covered.
+	)
+
+	Describe("datacenter inventory", func() {
+		// byPath returns the MOID and resource type of the objects keyed by path
+		byPath := func(objects []*models.VSphereManagementObject, err error) map[string]string {
+			Expect(err).To(BeNil())
+			paths := map[string]string{}
+			for _, o := range objects {
+				Expect(o.Moid).NotTo(BeEmpty())
+				Expect(o.Path).To(HaveSuffix("/" + o.Name))
+				paths[o.Path] = o.ResourceType
+			}
+			return paths
+		}
+
+		It("should list the clusters", func() {
+			Expect(byPath(client.GetClusters(ctx, dc.Reference().Value))).To(Equal(map[string]string{
+				"/DC0/host/DC0_C0": models.VSphereManagementObjectResourceTypeCluster,
+			}))
+		})
+
+		It("should list the clustered and standalone hosts", func() {
+			Expect(byPath(client.GetHosts(ctx, dc.Reference().Value))).To(Equal(map[string]string{
+				"/DC0/host/DC0_H0/DC0_H0":    models.VSphereManagementObjectResourceTypeHost,
+				"/DC0/host/DC0_C0/DC0_C0_H0": models.VSphereManagementObjectResourceTypeHost,
+				"/DC0/host/DC0_C0/DC0_C0_H1": models.VSphereManagementObjectResourceTypeHost,
+				"/DC0/host/DC0_C0/DC0_C0_H2": models.VSphereManagementObjectResourceTypeHost,
+			}))
+		})
+
+		It("should list the resource pools with the cluster root pools", func() {
+			pools, err := client.GetResourcePools(ctx, dc.Reference().Value)
+			Expect(byPath(pools, err)).To(Equal(map[string]string{
+				"/DC0/host/DC0_H0/Resources": models.VSphereManagementObjectResourceTypeRespool,
+				"/DC0/host/DC0_C0/Resources": models.VSphereManagementObjectResourceTypeRespool,
+			}))
+			cluster, err := finder.ClusterComputeResource(ctx, "DC0_C0")
+			Expect(err).To(BeNil())
+			for _, pool := range pools {
+				if pool.Path == "/DC0/host/DC0_C0/Resources" {
+					Expect(pool.ParentMoid).To(Equal(cluster.Reference().Value))
+				}
+			}
+		})
+
+		It("should only list the virtual machine folders", func() {
+			folders, err := dc.Folders(ctx)
+			Expect(err).To(BeNil())
+			for _, parent := range []*object.Folder{folders.VmFolder, folders.HostFolder} {
+				folder, err := parent.CreateFolder(ctx, "images")
+				Expect(err).To(BeNil())
+				DeferCleanup(func() {
+					task, err := folder.Destroy(ctx)
+					Expect(err).To(BeNil())
+					Expect(task.Wait(ctx)).To(Succeed())
+				})
+			}
+
+			Expect(byPath(client.GetFolders(ctx, dc.Reference().Value))).To(Equal(map[string]string{
+				"/DC0/vm":        models.VSphereManagementObjectResourceTypeFolder,
+				"/DC0/vm/images": models.VSphereManagementObjectResourceTypeFolder,
+			}))
+		})
+
+		It("should list the networks and port groups without the uplinks", func() {
+			// vcsim does not flag the uplink port group created with the distributed switch.
+			uplink, err := finder.Network(ctx, "DVS0-DVUplinks-9")
+			Expect(err).To(BeNil())
+			pg := simulator.Map.Get(uplink.Reference()).(*simulator.DistributedVirtualPortgroup)
+			simulator.Map.WithLock(simulator.SpoofContext(), pg, func() {
+				pg.Config.Uplink = types.NewBool(true)
+			})
+			DeferCleanup(func() {
+				simulator.Map.WithLock(simulator.SpoofContext(), pg, func() {
+					pg.Config.Uplink = nil
+				})
+			})
+
+			Expect(byPath(client.GetNetworks(ctx, dc.Reference().Value))).To(Equal(map[string]string{
+				"/DC0/network/VM Network": models.VSphereManagementObjectResourceTypeNetwork,
+				"/DC0/network/DC0_DVPG0":  models.VSphereManagementObjectResourceTypeNetwork,
+			}))
+		})
+
+		It("should list the datastores", func() {
+			Expect(byPath(client.GetDatastores(ctx, dc.Reference().Value))).To(Equal(map[string]string{
+				"/DC0/datastore/LocalDS_0": models.VSphereManagementObjectResourceTypeDatastore,
+			}))
+		})
+
+		DescribeTable("finding an object by name or path",
+			func(resourceType, name, fullPath string) {
+				obj, err := client.FindObject(ctx, dc.Reference().Value, resourceType, name)
+				Expect(err).To(BeNil())
+				ref, err := object.NewSearchIndex(client.vmomiClient.Client).FindByInventoryPath(ctx, fullPath)
+				Expect(err).To(BeNil())
+				Expect(ref).NotTo(BeNil())
+				Expect(obj).To(Equal(&models.VSphereManagementObject{
+					Moid:         ref.Reference().Value,
+					Name:         fullPath[strings.LastIndex(fullPath, "/")+1:],
+					Path:         fullPath,
+					ResourceType: resourceType,
+				}))
+			},
+			Entry("datastore", models.VSphereManagementObjectResourceTypeDatastore, "LocalDS_0", "/DC0/datastore/LocalDS_0"),
+			Entry("network", models.VSphereManagementObjectResourceTypeNetwork, "VM Network", "/DC0/network/VM Network"),
+			Entry("distributed port group", models.VSphereManagementObjectResourceTypeNetwork, "DC0_DVPG0", "/DC0/network/DC0_DVPG0"),
+			Entry("folder path", models.VSphereManagementObjectResourceTypeFolder, "/DC0/vm", "/DC0/vm"),
+			Entry("resource pool path", models.VSphereManagementObjectResourceTypeRespool, "DC0_C0/Resources", "/DC0/host/DC0_C0/Resources"),
+			Entry("cluster", models.VSphereManagementObjectResourceTypeCluster, "DC0_C0", "/DC0/host/DC0_C0"),
+		)
+
+		It("should return the placement of the first virtual machine found", func() {
+			placement, err := client.GetVirtualMachinePlacement(ctx, dc.Reference().Value, []string{"missing", "DC0_C0_RP0_VM0", "DC0_H0_VM0"})
+			Expect(err).To(BeNil())
+			Expect(placement).NotTo(BeNil())
+			Expect(placement.Cluster.Path).To(Equal("/DC0/host/DC0_C0"))
+			Expect(placement.ResourcePool.Path).To(Equal("/DC0/host/DC0_C0/Resources"))
+			Expect(placement.Networks).NotTo(BeEmpty())
+
+			// Standalone hosts have no cluster.
+			placement, err = client.GetVirtualMachinePlacement(ctx, dc.Reference().Value, []string{"DC0_H0_VM0"})
+			Expect(err).To(BeNil())
+			Expect(placement.Cluster).To(BeNil())
+			Expect(placement.ResourcePool.Path).To(Equal("/DC0/host/DC0_H0/Resources"))
+
+			placement, err = client.GetVirtualMachinePlacement(ctx, dc.Reference().Value, []string{"missing"})
+			Expect(err).To(BeNil())
+			Expect(placement).To(BeNil())
+		})
+
+		It("should not find a missing object", func() {
+			_, err := client.FindObject(ctx, dc.Reference().Value, models.VSphereManagementObjectResourceTypeDatastore, "missing")
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+		})
+
+		It("should reject the unsupported resource types", func() {
+			_, err := client.FindObject(ctx, dc.Reference().Value, models.VSphereManagementObjectResourceTypeHost, "DC0_H0")
+			Expect(err).To(MatchError("resource type host is not supported"))
+		})
+	})
+
+	It("should resolve the parents of a MOID by their reference type", func() {
+		host, err := finder.HostSystem(ctx, "/DC0/host/DC0_H0/DC0_H0")
+		Expect(err).To(BeNil())
+
+		path, objects, err := client.GetPath(ctx, host.Reference().Value)
+		Expect(err).To(BeNil())
+		Expect(path).To(Equal("/DC0/host/DC0_H0/DC0_H0"))
+		Expect(objects).To(HaveLen(2))
+		Expect(objects[1].Moid).To(Equal(objects[0].ParentMoid))
+		Expect(objects[1].ResourceType).To(Equal(models.VSphereManagementObjectResourceTypeHost))
+	})
+
+	It("should guess the type of the vCenter MOIDs", func() {
+		Expect(moidType("domain-c8")).To(Equal(TypeCluster))
+		Expect(moidType("domain-s10")).To(Equal(TypeComputeResource))
+		Expect(moidType("host-12")).To(Equal(TypeHostSystem))
+		Expect(moidType("computeresource-23")).To(BeEmpty())
+	})
+
+	It("should reject an unknown MOID", func() {
+		_, _, err := client.GetPath(ctx, "unknown-1")
+		Expect(err).NotTo(BeNil())
+	})
+
+	Describe("imported images", func() {
+		vApp := &types.VmConfigSpec{Property: []types.VAppPropertySpec{{
+			ArrayUpdateSpec: types.ArrayUpdateSpec{Operation: types.ArrayUpdateOperationAdd},
+			Info:            &types.VAppPropertyInfo{Key: 1, Id: "VERSION", DefaultValue: "v1.23.8+vmware.1"},
+		}}}
+
+		BeforeEach(func() {
+			template := createVM("windows-2019-kube-v1.23.8", nil, vApp)
+			Expect(template.MarkAsTemplate(ctx)).To(Succeed())
+			createVM("ubuntu-2004-kube-v1.23.8", nil, nil)
+			createVM("workload-node", []types.BaseOptionValue{
+				&types.OptionValue{Key: VMGuestInfoUserDataKey, Value: "I2Nsb3VkLWNvbmZpZwo="},
+			}, nil)
+
+			running := createVM("running-image", nil, nil)
+			task, err := running.PowerOn(ctx)
+			Expect(err).To(BeNil())
+			Expect(task.Wait(ctx)).To(Succeed())
+		})
+
+		importedImages := func() map[string]mo.VirtualMachine {
+			vms, err := client.GetImportedVirtualMachinesImages(ctx, dc.Reference().Value)
+			Expect(err).To(BeNil())
+			images := map[string]mo.VirtualMachine{}
+			for _, vm := range vms {
+				images[vm.Name] = vm
+			}
+			return images
+		}
+
+		It("should return the templates and the powered off VMs without user data", func() {
+			images := importedImages()
+			Expect(images).To(HaveLen(2))
+			Expect(images).To(HaveKey("windows-2019-kube-v1.23.8"))
+			Expect(images).To(HaveKey("ubuntu-2004-kube-v1.23.8"))
+			Expect(images["windows-2019-kube-v1.23.8"].Config.Template).To(BeTrue())
+			Expect(images["windows-2019-kube-v1.23.8"].Parent).NotTo(BeNil())
+			Expect(images["windows-2019-kube-v1.23.8"].Parent.Type).To(Equal("Folder"))
+		})
+
+		It("should read the vApp properties", func() {
+			images := importedImages()
+			template := images["windows-2019-kube-v1.23.8"]
+			Expect(client.GetVMMetadata(&template)).To(Equal(map[string]string{"VERSION": "v1.23.8+vmware.1"}))
+
+			vm := images["ubuntu-2004-kube-v1.23.8"]
+			Expect(client.GetVMMetadata(&vm)).To(BeEmpty())
+		})
+	})
+
+	Describe("virtual machine watch", func() {
+		var (
+			updates  chan VirtualMachineUpdate
+			template *object.VirtualMachine
+		)
+
+		BeforeEach(func() {
+			template = createVM("windows-2019-kube-v1.23.8", nil, nil)
+			Expect(template.MarkAsTemplate(ctx)).To(Succeed())
+
+			updates = make(chan VirtualMachineUpdate, 100)
+			watchCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				done <- client.WatchVirtualMachines(watchCtx, dc.Reference().Value, func(changes []VirtualMachineUpdate) {
+					for _, change := range changes {
+						updates <- change
+					}
+				})
+			}()
+			DeferCleanup(func() {
+				cancel()
+				Eventually(done).Should(Receive(MatchError(context.Canceled)))
+			})
+
+			rename := func(name string) {
+				task, err := template.Rename(ctx, name)
+				Expect(err).To(BeNil())
+				Expect(task.Wait(ctx)).To(Succeed())
+			}
+			// The existing templates are not reported, rename until the subscription is up.
+			attempt := 0
+			Eventually(func() <-chan VirtualMachineUpdate {
+				attempt++
+				rename(fmt.Sprintf("windows-2019-%d", attempt))
+				return updates
+			}).Should(Receive())
+			rename("windows-2019")
+			Eventually(updates).Should(Receive(Equal(VirtualMachineUpdate{Moid: template.Reference().Value, Name: "windows-2019", Template: true})))
+		})
+
+		It("should report the new templates", func() {
+			vm := createVM("ubuntu-2004-kube-v1.23.8", nil, nil)
+			Expect(vm.MarkAsTemplate(ctx)).To(Succeed())
+			// vcsim does not publish the config.template change, the watch misses it once
+			// the virtual machine creation was reported.
+			obj := simulator.Map.Get(vm.Reference())
+			simulator.Map.WithLock(simulator.SpoofContext(), obj, func() {
+				simulator.Map.Update(obj, []types.PropertyChange{{Name: "config.template", Val: true}})
+			})
+			Eventually(updates).Should(Receive(Equal(VirtualMachineUpdate{Moid: vm.Reference().Value, Name: "ubuntu-2004-kube-v1.23.8", Template: true})))
+		})
+
+		It("should report the destroyed templates", func() {
+			task, err := template.Destroy(ctx)
+			Expect(err).To(BeNil())
+			Expect(task.Wait(ctx)).To(Succeed())
+			Eventually(updates).Should(Receive(Equal(VirtualMachineUpdate{Moid: template.Reference().Value, Name: "windows-2019", Template: true, Removed: true})))
+			Consistently(updates, "200ms").ShouldNot(Receive())
+		})
+
+		It("should ignore the other virtual machines", func() {
+			createVM("workload-node", nil, nil)
+			Consistently(updates, "200ms").ShouldNot(Receive())
+		})
+	})
+
+	Describe("datastore search", func() {
+		var ds *object.Datastore
+
+		BeforeEach(func() {
+			var err error
+			ds, err = finder.Datastore(ctx, "LocalDS_0")
+			Expect(err).To(BeNil())
+			Expect(ds.Upload(ctx, strings.NewReader("iso"), "iso/windows.iso", &soap.DefaultUpload)).To(Succeed())
+			DeferCleanup(func() {
+				task, err := object.NewFileManager(client.vmomiClient.Client).DeleteDatastoreFile(ctx, ds.Path("iso"), dc)
+				Expect(err).To(BeNil())
+				Expect(task.Wait(ctx)).To(Succeed())
+			})
+		})
+
+		It("should find the file of the path", func() {
+			files, err := SearchDatastore(ctx, ds, "iso/windows.iso")
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+			Expect(files[0].Path).To(Equal("windows.iso"))
+			Expect(files[0].FileSize).To(BeEquivalentTo(3))
+		})
+
+		It("should match the file pattern", func() {
+			files, err := SearchDatastore(ctx, ds, "iso/*.iso")
+			Expect(err).To(BeNil())
+			Expect(files).To(HaveLen(1))
+		})
+
+		It("should not find a missing file", func() {
+			files, err := SearchDatastore(ctx, ds, "iso/vmtools.iso")
+			Expect(err).To(BeNil())
+			Expect(files).To(BeEmpty())
+
+			exists, err := client.DatastoreFileExists(ctx, dc.Reference().Value, "LocalDS_0", "iso/vmtools.iso")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("should check the file from the datastore root", func() {
+			exists, err := client.DatastoreFileExists(ctx, dc.Reference().Value, "LocalDS_0", "iso/windows.iso")
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeTrue())
+		})
+	})
+})
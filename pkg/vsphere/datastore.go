@@ -7,21 +7,15 @@ import (
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/vim25/types"
 	"path"
-	"time"
 )
 
-const DefaultAPITimeout = time.Minute * 5
-
-// Browser returns the HostDatastoreBrowser for a certain datastore. This is a
-// convenience method that exists to abstract the context.
-func Browser(ds *object.Datastore) (*object.HostDatastoreBrowser, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
-	defer cancel()
+// Browser returns the HostDatastoreBrowser for a certain datastore.
+func Browser(ctx context.Context, ds *object.Datastore) (*object.HostDatastoreBrowser, error) {
 	return ds.Browser(ctx)
 }
 
-func searchDatastore(ds *object.Datastore, name string) (*types.HostDatastoreBrowserSearchResults, error) {
-	browser, err := Browser(ds)
+func searchDatastore(ctx context.Context, ds *object.Datastore, name string) (*types.HostDatastoreBrowserSearchResults, error) {
+	browser, err := Browser(ctx, ds)
 	if err != nil {
 		return nil, err
 	}
@@ -50,15 +44,11 @@ func searchDatastore(ds *object.Datastore, name string) (*types.HostDatastoreBro
 			Modification: true,
 		},
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
-	defer cancel()
 	task, err := browser.SearchDatastore(ctx, dp.String(), spec)
 	if err != nil {
 		return nil, err
 	}
-	tctx, tcancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
-	defer tcancel()
-	info, err := task.WaitForResult(tctx, nil)
+	info, err := task.WaitForResult(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -69,9 +59,9 @@ func searchDatastore(ds *object.Datastore, name string) (*types.HostDatastoreBro
 // SearchDatastore searches a datastore using the supplied HostDatastoreBrowser
 // and a supplied path. The current implementation only returns the basic
 // information, so all FileQueryFlags set, but not any flags for specific types
-// of files.
-func SearchDatastore(ds *object.Datastore, name string) ([]*types.FileInfo, error) {
-	result, err := searchDatastore(ds, name)
+// of files. The search is bounded by the context deadline.
+func SearchDatastore(ctx context.Context, ds *object.Datastore, name string) ([]*types.FileInfo, error) {
+	result, err := searchDatastore(ctx, ds, name)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,413 @@
+// Package fake provides an in-memory vsphere.Client for the controller tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"github.com/vmware/govmomi/vim25/mo"
+)
+
+var _ vsphere.Client = &Client{}
+
+// Datacenter is the inventory of a datacenter
+type Datacenter struct {
+	// Objects are the clusters, hosts, resource pools, folders, networks and
+	// datastores, each getter returns the objects of its resource type.
+	Objects []*models.VSphereManagementObject
+
+	// Capacities are the datastore capacities by MOID
+	Capacities map[string]vsphere.DatastoreCapacity
+
+	// VirtualMachines are returned by GetVirtualMachines and, as they are, by
+	// GetImportedVirtualMachinesImages.
+	VirtualMachines []mo.VirtualMachine
+
+	// Placements are the virtual machine placements by name
+	Placements map[string]*vsphere.VirtualMachinePlacement
+
+	// Files are the file paths of each datastore name, relative to the datastore root.
+	// The datastores can be searched by name or inventory path.
+	Files map[string][]string
+}
+
+// Client is an in-memory vsphere.Client, tests fill the datacenter inventories and
+// can make any method fail. The calls are recorded and it is safe for concurrent use.
+type Client struct {
+	mu sync.Mutex
+
+	// Datacenters are returned by GetDatacenters, the name is the datacenter path
+	Datacenters []*models.VSphereDatacenter
+
+	// Inventory holds the datacenter inventories by MOID
+	Inventory map[string]*Datacenter
+
+	// Errors are returned by the methods of the name, like "GetDatacenters"
+	Errors map[string]error
+
+	loggedIn bool
+	calls    []string
+	watches  map[string][]*watch
+}
+
+// watch is a WatchVirtualMachines subscription
+type watch struct {
+	updates chan []vsphere.VirtualMachineUpdate
+	dropped chan struct{}
+}
+
+// NewClient returns a logged in client with an empty inventory
+func NewClient() *Client {
+	return &Client{
+		Inventory: map[string]*Datacenter{},
+		Errors:    map[string]error{},
+		loggedIn:  true,
+	}
+}
+
+// AddDatacenter adds an empty datacenter with the MOID and path, its inventory is returned
+func (c *Client) AddDatacenter(moid, name string) *Datacenter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Inventory == nil {
+		c.Inventory = map[string]*Datacenter{}
+	}
+	c.Datacenters = append(c.Datacenters, &models.VSphereDatacenter{Moid: moid, Name: name})
+	dc := &Datacenter{
+		Capacities: map[string]vsphere.DatastoreCapacity{},
+		Placements: map[string]*vsphere.VirtualMachinePlacement{},
+		Files:      map[string][]string{},
+	}
+	c.Inventory[moid] = dc
+	return dc
+}
+
+// Calls returns the names of the called methods in order
+func (c *Client) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// call records the method call and returns its injected error, the lock is held
+// by the caller.
+func (c *Client) call(ctx context.Context, method string) error {
+	c.calls = append(c.calls, method)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Errors[method]
+}
+
+// datacenter returns the inventory of the datacenter MOID, the lock is held by the caller
+func (c *Client) datacenter(datacenterMOID string) (*Datacenter, error) {
+	dc, ok := c.Inventory[datacenterMOID]
+	if !ok {
+		return nil, fmt.Errorf("datacenter %s not found", datacenterMOID)
+	}
+	return dc, nil
+}
+
+// objects returns the objects of the resource type in the datacenter
+func (c *Client) objects(ctx context.Context, method, datacenterMOID, resourceType string) ([]*models.VSphereManagementObject, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, method); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	results := []*models.VSphereManagementObject{}
+	for _, obj := range dc.Objects {
+		if obj.ResourceType == resourceType {
+			copied := *obj
+			results = append(results, &copied)
+		}
+	}
+	return results, nil
+}
+
+// Login starts the session
+func (c *Client) Login(ctx context.Context, user, password string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "Login"); err != nil {
+		return "", err
+	}
+	c.loggedIn = true
+	return "fake-ticket", nil
+}
+
+// AcquireTicket returns a session ticket
+func (c *Client) AcquireTicket(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "AcquireTicket"); err != nil {
+		return "", err
+	}
+	return "fake-ticket", nil
+}
+
+// Logout ends the session
+func (c *Client) Logout(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "Logout"); err != nil {
+		return err
+	}
+	c.loggedIn = false
+	return nil
+}
+
+// CheckUserSessionActive returns true until Logout is called
+func (c *Client) CheckUserSessionActive(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "CheckUserSessionActive"); err != nil {
+		return false, err
+	}
+	return c.loggedIn, nil
+}
+
+// GetDatacenters returns the datacenters
+func (c *Client) GetDatacenters(ctx context.Context) ([]*models.VSphereDatacenter, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "GetDatacenters"); err != nil {
+		return nil, err
+	}
+	results := make([]*models.VSphereDatacenter, 0, len(c.Datacenters))
+	for _, dc := range c.Datacenters {
+		copied := *dc
+		results = append(results, &copied)
+	}
+	return results, nil
+}
+
+// GetClusters returns the cluster objects of the datacenter
+func (c *Client) GetClusters(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetClusters", datacenterMOID, models.VSphereManagementObjectResourceTypeCluster)
+}
+
+// GetHosts returns the host objects of the datacenter
+func (c *Client) GetHosts(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetHosts", datacenterMOID, models.VSphereManagementObjectResourceTypeHost)
+}
+
+// GetResourcePools returns the resource pool objects of the datacenter
+func (c *Client) GetResourcePools(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetResourcePools", datacenterMOID, models.VSphereManagementObjectResourceTypeRespool)
+}
+
+// GetFolders returns the folder objects of the datacenter
+func (c *Client) GetFolders(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetFolders", datacenterMOID, models.VSphereManagementObjectResourceTypeFolder)
+}
+
+// GetNetworks returns the network objects of the datacenter
+func (c *Client) GetNetworks(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetNetworks", datacenterMOID, models.VSphereManagementObjectResourceTypeNetwork)
+}
+
+// GetDatastores returns the datastore objects of the datacenter
+func (c *Client) GetDatastores(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	return c.objects(ctx, "GetDatastores", datacenterMOID, models.VSphereManagementObjectResourceTypeDatastore)
+}
+
+// GetDatastoreCapacities returns the datastore capacities of the datacenter
+func (c *Client) GetDatastoreCapacities(ctx context.Context, datacenterMOID string) (map[string]vsphere.DatastoreCapacity, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "GetDatastoreCapacities"); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	capacities := make(map[string]vsphere.DatastoreCapacity, len(dc.Capacities))
+	for moid, capacity := range dc.Capacities {
+		capacities[moid] = capacity
+	}
+	return capacities, nil
+}
+
+// GetVirtualMachinePlacement returns the placement of the first virtual machine of
+// the names with one, nil when none has.
+func (c *Client) GetVirtualMachinePlacement(ctx context.Context, datacenterMOID string, names []string) (*vsphere.VirtualMachinePlacement, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "GetVirtualMachinePlacement"); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if placement, ok := dc.Placements[name]; ok {
+			return placement, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetVirtualMachines returns the virtual machines of the datacenter
+func (c *Client) GetVirtualMachines(ctx context.Context, datacenterMOID string) ([]*models.VSphereVirtualMachine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "GetVirtualMachines"); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	results := []*models.VSphereVirtualMachine{}
+	for _, vm := range dc.VirtualMachines {
+		template := vm.Config != nil && vm.Config.Template
+		results = append(results, &models.VSphereVirtualMachine{Name: vm.Name, Moid: vm.Self.Value, IsTemplate: &template})
+	}
+	return results, nil
+}
+
+// GetVMMetadata returns the vApp properties of the virtual machine
+func (c *Client) GetVMMetadata(vm *mo.VirtualMachine) map[string]string {
+	return vsphere.VMMetadata(vm)
+}
+
+// GetImportedVirtualMachinesImages returns the virtual machines of the datacenter
+func (c *Client) GetImportedVirtualMachinesImages(ctx context.Context, datacenterMOID string) ([]mo.VirtualMachine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "GetImportedVirtualMachinesImages"); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]mo.VirtualMachine{}, dc.VirtualMachines...), nil
+}
+
+// FindObject returns the object of the resource type with the name or path
+func (c *Client) FindObject(ctx context.Context, datacenterMOID, resourceType, name string) (*models.VSphereManagementObject, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "FindObject"); err != nil {
+		return nil, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range dc.Objects {
+		if obj.ResourceType == resourceType && (obj.Name == name || obj.Path == name) {
+			copied := *obj
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("%s '%s' not found", resourceType, name)
+}
+
+// DatastoreFileExists returns true when the datastore holds the file
+func (c *Client) DatastoreFileExists(ctx context.Context, datacenterMOID, datastore, filePath string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.call(ctx, "DatastoreFileExists"); err != nil {
+		return false, err
+	}
+	dc, err := c.datacenter(datacenterMOID)
+	if err != nil {
+		return false, err
+	}
+	files, ok := dc.Files[path.Base(datastore)]
+	if !ok {
+		return false, fmt.Errorf("datastore '%s' not found", datastore)
+	}
+	for _, f := range files {
+		if path.Join("/", f) == path.Join("/", filePath) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WatchVirtualMachines delivers the updates sent with Notify until the context is
+// done or DropWatches is called.
+func (c *Client) WatchVirtualMachines(ctx context.Context, datacenterMOID string, onUpdates func([]vsphere.VirtualMachineUpdate)) error {
+	c.mu.Lock()
+	if err := c.call(ctx, "WatchVirtualMachines"); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if _, err := c.datacenter(datacenterMOID); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if c.watches == nil {
+		c.watches = map[string][]*watch{}
+	}
+	w := &watch{updates: make(chan []vsphere.VirtualMachineUpdate, 16), dropped: make(chan struct{})}
+	c.watches[datacenterMOID] = append(c.watches[datacenterMOID], w)
+	c.mu.Unlock()
+
+	defer c.removeWatch(datacenterMOID, w)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.dropped:
+			return fmt.Errorf("the session was dropped")
+		case updates := <-w.updates:
+			onUpdates(updates)
+		}
+	}
+}
+
+// removeWatch removes the subscription of the datacenter
+func (c *Client) removeWatch(datacenterMOID string, w *watch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	watches := c.watches[datacenterMOID]
+	for i := range watches {
+		if watches[i] == w {
+			c.watches[datacenterMOID] = append(watches[:i], watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// Watches returns the number of subscriptions on the datacenter
+func (c *Client) Watches(datacenterMOID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.watches[datacenterMOID])
+}
+
+// Notify sends the updates to the subscriptions on the datacenter
+func (c *Client) Notify(datacenterMOID string, updates ...vsphere.VirtualMachineUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.watches[datacenterMOID] {
+		w.updates <- updates
+	}
+}
+
+// DropWatches ends every subscription with an error, like an expired session
+func (c *Client) DropWatches() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, watches := range c.watches {
+		for _, w := range watches {
+			close(w.dropped)
+		}
+	}
+	c.watches = nil
+}
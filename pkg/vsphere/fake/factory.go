@@ -0,0 +1,63 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/knabben/tkw/pkg/vsphere"
+)
+
+var _ vsphere.ClientFactory = &ClientFactory{}
+
+// ClientFactory returns the fake clients by vCenter server, it records the logins
+// and the clients not released. It is safe for concurrent use.
+type ClientFactory struct {
+	mu sync.Mutex
+
+	// Clients are the fake clients by vCenter server
+	Clients map[string]*Client
+
+	logins []string
+	held   int
+}
+
+// NewClientFactory returns a factory of the client for the server
+func NewClientFactory(server string, client *Client) *ClientFactory {
+	return &ClientFactory{Clients: map[string]*Client{server: client}}
+}
+
+// Get returns the client of the server, unknown servers are unreachable
+func (f *ClientFactory) Get(ctx context.Context, server, username, password string, tlsConfig vsphere.TLSConfig) (vsphere.Client, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logins = append(f.logins, fmt.Sprintf("%s@%s", username, server))
+	client, ok := f.Clients[server]
+	if !ok {
+		return nil, nil, fmt.Errorf("vCenter %s is unreachable", server)
+	}
+	f.held++
+
+	var once sync.Once
+	return client, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			f.held--
+		})
+	}, nil
+}
+
+// Held returns the number of clients returned by Get and not released
+func (f *ClientFactory) Held() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.held
+}
+
+// Logins returns the username@server of the Get calls in order
+func (f *ClientFactory) Logins() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.logins...)
+}
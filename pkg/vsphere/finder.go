@@ -0,0 +1,98 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// newFinder returns an inventory finder scoped to the datacenter
+func (c *DefaultClient) newFinder(datacenterMOID string) *find.Finder {
+	finder := find.NewFinder(c.vmomiClient.Client)
+	ref := types.ManagedObjectReference{Type: TypeDatacenter, Value: datacenterMOID}
+	return finder.SetDatacenter(object.NewDatacenter(c.vmomiClient.Client, ref))
+}
+
+// FindObject finds an inventory object of the resource type by name or path in the datacenter
+func (c *DefaultClient) FindObject(ctx context.Context, datacenterMOID, resourceType, name string) (*models.VSphereManagementObject, error) {
+	if c.vmomiClient == nil {
+		return nil, fmt.Errorf("uninitialized vmomi client")
+	}
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	finder := c.newFinder(datacenterMOID)
+
+	var (
+		ref types.ManagedObjectReference
+		err error
+	)
+	switch resourceType {
+	case models.VSphereManagementObjectResourceTypeDatastore:
+		var ds *object.Datastore
+		if ds, err = finder.Datastore(ctx, name); err == nil {
+			ref = ds.Reference()
+		}
+	case models.VSphereManagementObjectResourceTypeNetwork:
+		var network object.NetworkReference
+		if network, err = finder.Network(ctx, name); err == nil {
+			ref = network.Reference()
+		}
+	case models.VSphereManagementObjectResourceTypeFolder:
+		var folder *object.Folder
+		if folder, err = finder.Folder(ctx, name); err == nil {
+			ref = folder.Reference()
+		}
+	case models.VSphereManagementObjectResourceTypeRespool:
+		var pool *object.ResourcePool
+		if pool, err = finder.ResourcePool(ctx, name); err == nil {
+			ref = pool.Reference()
+		}
+	case models.VSphereManagementObjectResourceTypeCluster:
+		var cluster *object.ClusterComputeResource
+		if cluster, err = finder.ClusterComputeResource(ctx, name); err == nil {
+			ref = cluster.Reference()
+		}
+	default:
+		return nil, fmt.Errorf("resource type %s is not supported", resourceType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The path is informative, objects outside the known types have none.
+	fullPath, _, _ := c.getPath(ctx, ref)
+	return &models.VSphereManagementObject{
+		Moid:         ref.Value,
+		Name:         path.Base(name),
+		Path:         fullPath,
+		ResourceType: resourceType,
+	}, nil
+}
+
+// DatastoreFileExists returns true when the file exists in the datastore, the
+// file path is relative to the datastore root. The search task is bounded by the
+// task timeout.
+func (c *DefaultClient) DatastoreFileExists(ctx context.Context, datacenterMOID, datastore, filePath string) (bool, error) {
+	if c.vmomiClient == nil {
+		return false, fmt.Errorf("uninitialized vmomi client")
+	}
+	findCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	ds, err := c.newFinder(datacenterMOID).Datastore(findCtx, datastore)
+	if err != nil {
+		return false, err
+	}
+
+	taskCtx, cancel := withTimeout(ctx, c.timeouts.Task)
+	defer cancel()
+	files, err := SearchDatastore(taskCtx, ds, path.Join("/", filePath))
+	if err != nil {
+		return false, err
+	}
+	return len(files) > 0, nil
+}
@@ -11,12 +11,12 @@ import (
 )
 
 // ConnectFilterDC connects on vSphere and login using credentials
-func ConnectFilterDC(ctx context.Context, vc, user, pass, dcName string) (Client, *models.VSphereDatacenter, error) {
+func ConnectFilterDC(ctx context.Context, vc, user, pass, dcName string, tlsConfig TLSConfig, timeouts Timeouts) (Client, *models.VSphereDatacenter, error) {
 	var (
 		client Client
 		err    error
 	)
-	client, err = ConnectVCLogin(vc, user, pass)
+	client, err = ConnectVCLogin(ctx, vc, user, pass, tlsConfig, timeouts)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -31,9 +31,9 @@ func ConnectFilterDC(ctx context.Context, vc, user, pass, dcName string) (Client
 	return client, dc, nil
 }
 
-// ConnectVCLogin returns the logged client.
-func ConnectVCLogin(server, username, password string) (Client, error) {
-	var ctx = context.Background()
+// ConnectVCLogin returns the logged client, the vCenter certificate is verified
+// with the TLS settings and the calls are bounded by the timeouts.
+func ConnectVCLogin(ctx context.Context, server, username, password string, tlsConfig TLSConfig, timeouts Timeouts) (Client, error) {
 	if !strings.HasPrefix(server, "http") {
 		server = "https://" + server
 	}
@@ -43,7 +43,7 @@ func ConnectVCLogin(server, username, password string) (Client, error) {
 		return nil, err
 	}
 	vc.Path = "/sdk"
-	vcClient, err := NewClient(vc, "", true)
+	vcClient, err := NewClient(ctx, vc, tlsConfig, timeouts)
 	if err != nil {
 		return nil, err
 	}
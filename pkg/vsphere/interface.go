@@ -18,15 +18,28 @@ const (
 	TypeDvpg            = "DistributedVirtualPortgroup"
 	TypeDvs             = "VmwareDistributedVirtualSwitch"
 	TypeVirtualMachine  = "VirtualMachine"
+	TypeHostSystem      = "HostSystem"
 )
 
 // Client represents a vCenter client
 type Client interface {
 	Login(ctx context.Context, user, password string) (string, error)
-	AcquireTicket() (string, error)
-	CheckUserSessionActive() (bool, error)
+	AcquireTicket(ctx context.Context) (string, error)
+	Logout(ctx context.Context) error
+	CheckUserSessionActive(ctx context.Context) (bool, error)
 	GetDatacenters(ctx context.Context) ([]*models.VSphereDatacenter, error)
+	GetClusters(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetHosts(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetResourcePools(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetFolders(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetNetworks(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetDatastores(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error)
+	GetDatastoreCapacities(ctx context.Context, datacenterMOID string) (map[string]DatastoreCapacity, error)
+	GetVirtualMachinePlacement(ctx context.Context, datacenterMOID string, names []string) (*VirtualMachinePlacement, error)
 	GetVirtualMachines(ctx context.Context, datacenterMOID string) ([]*models.VSphereVirtualMachine, error)
 	GetVMMetadata(vm *mo.VirtualMachine) (properties map[string]string)
 	GetImportedVirtualMachinesImages(ctx context.Context, datacenterMOID string) ([]mo.VirtualMachine, error)
+	FindObject(ctx context.Context, datacenterMOID, resourceType, name string) (*models.VSphereManagementObject, error)
+	DatastoreFileExists(ctx context.Context, datacenterMOID, datastore, filePath string) (bool, error)
+	WatchVirtualMachines(ctx context.Context, datacenterMOID string, onUpdates func([]VirtualMachineUpdate)) error
 }
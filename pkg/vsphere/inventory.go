@@ -0,0 +1,251 @@
+package vsphere
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/knabben/tkw/pkg/vsphere/models"
+	"github.com/pkg/errors"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// GetClusters returns the compute clusters in the datacenter
+func (c *DefaultClient) GetClusters(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var entities []mo.ManagedEntity
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeCluster}, []string{"name"}, &entities); err != nil {
+		return nil, errors.Wrap(err, "failed to get clusters")
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeCluster), nil
+}
+
+// GetHosts returns the ESXi hosts in the datacenter, clustered or standalone
+func (c *DefaultClient) GetHosts(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var entities []mo.ManagedEntity
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeHostSystem}, []string{"name"}, &entities); err != nil {
+		return nil, errors.Wrap(err, "failed to get hosts")
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeHost), nil
+}
+
+// GetResourcePools returns the resource pools in the datacenter, including the cluster root pools
+func (c *DefaultClient) GetResourcePools(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var entities []mo.ManagedEntity
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeResourcePool}, []string{"name"}, &entities); err != nil {
+		return nil, errors.Wrap(err, "failed to get resource pools")
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeRespool), nil
+}
+
+// GetFolders returns the folders in the datacenter that can hold virtual machines
+func (c *DefaultClient) GetFolders(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var folders []mo.Folder
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeFolder}, []string{"name", "childType"}, &folders); err != nil {
+		return nil, errors.Wrap(err, "failed to get folders")
+	}
+
+	var entities []mo.ManagedEntity
+	for i := range folders {
+		if isVMFolder(&folders[i]) {
+			entities = append(entities, folders[i].ManagedEntity)
+		}
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeFolder), nil
+}
+
+// GetNetworks returns the standard networks and distributed port groups in the
+// datacenter, the distributed switch uplink port groups are skipped.
+func (c *DefaultClient) GetNetworks(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var networks []mo.Network
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeNetwork}, []string{"name"}, &networks); err != nil {
+		return nil, errors.Wrap(err, "failed to get networks")
+	}
+	var portgroups []mo.DistributedVirtualPortgroup
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeDvpg}, []string{"config.uplink"}, &portgroups); err != nil {
+		return nil, errors.Wrap(err, "failed to get distributed port groups")
+	}
+	uplinks := map[string]bool{}
+	for _, pg := range portgroups {
+		if pg.Config.Uplink != nil && *pg.Config.Uplink {
+			uplinks[pg.Self.Value] = true
+		}
+	}
+
+	var entities []mo.ManagedEntity
+	for i := range networks {
+		if uplinks[networks[i].Self.Value] {
+			continue
+		}
+		// Network shadows the ManagedEntity name.
+		entity := networks[i].ManagedEntity
+		entity.Name = networks[i].Name
+		entities = append(entities, entity)
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeNetwork), nil
+}
+
+// GetDatastores returns the datastores in the datacenter
+func (c *DefaultClient) GetDatastores(ctx context.Context, datacenterMOID string) ([]*models.VSphereManagementObject, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var entities []mo.ManagedEntity
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeDatastore}, []string{"name"}, &entities); err != nil {
+		return nil, errors.Wrap(err, "failed to get datastores")
+	}
+	return c.toManagementObjects(ctx, entities, models.VSphereManagementObjectResourceTypeDatastore), nil
+}
+
+// retrieveDatacenterObjects loads the properties of the objects of the view types under the datacenter in dst
+func (c *DefaultClient) retrieveDatacenterObjects(ctx context.Context, datacenterMOID string, viewTypes, properties []string, dst interface{}) error {
+	if c.vmomiClient == nil {
+		return fmt.Errorf("uninitialized vmomi client")
+	}
+
+	dcRef := TypeDatacenter + ":" + datacenterMOID
+	view, err := c.createContainerView(ctx, dcRef, viewTypes)
+	if err != nil {
+		return errors.Wrap(err, "error creating container view")
+	}
+	defer func() {
+		_ = view.Destroy(ctx)
+	}()
+
+	return view.Retrieve(ctx, viewTypes, properties, dst)
+}
+
+// toManagementObjects converts the entities in management objects with their full
+// path, entities without a valid path are skipped.
+func (c *DefaultClient) toManagementObjects(ctx context.Context, entities []mo.ManagedEntity, resourceType string) []*models.VSphereManagementObject {
+	results := []*models.VSphereManagementObject{}
+	for i := range entities {
+		moid := entities[i].Self.Value
+		path, objects, err := c.getPath(ctx, entities[i].Self)
+		if err != nil {
+			continue
+		}
+		obj := &models.VSphereManagementObject{
+			Moid:         moid,
+			Name:         entities[i].Name,
+			Path:         path,
+			ResourceType: resourceType,
+		}
+		// GetPath returns the object itself first, unless it is a datacenter default folder.
+		if len(objects) > 0 && objects[0].Moid == moid {
+			obj.ParentMoid = objects[0].ParentMoid
+		}
+		results = append(results, obj)
+	}
+	return results
+}
+
+// isVMFolder returns true when the folder accepts virtual machines
+func isVMFolder(folder *mo.Folder) bool {
+	for _, childType := range folder.ChildType {
+		if childType == TypeVirtualMachine {
+			return true
+		}
+	}
+	return false
+}
+
+// DatastoreCapacity holds the datastore capacity and free space in bytes
+type DatastoreCapacity struct {
+	Capacity  int64
+	FreeSpace int64
+}
+
+// GetDatastoreCapacities returns the capacity of the datastores in the datacenter keyed by MOID
+func (c *DefaultClient) GetDatastoreCapacities(ctx context.Context, datacenterMOID string) (map[string]DatastoreCapacity, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var datastores []mo.Datastore
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeDatastore}, []string{"summary"}, &datastores); err != nil {
+		return nil, errors.Wrap(err, "failed to get datastores summary")
+	}
+
+	capacities := make(map[string]DatastoreCapacity, len(datastores))
+	for _, ds := range datastores {
+		capacities[ds.Self.Value] = DatastoreCapacity{
+			Capacity:  ds.Summary.Capacity,
+			FreeSpace: ds.Summary.FreeSpace,
+		}
+	}
+	return capacities, nil
+}
+
+// VirtualMachinePlacement holds the inventory objects hosting a virtual machine
+type VirtualMachinePlacement struct {
+	Cluster      *models.VSphereManagementObject
+	ResourcePool *models.VSphereManagementObject
+	Networks     []*models.VSphereManagementObject
+}
+
+// GetVirtualMachinePlacement returns the cluster, resource pool and networks of the
+// first virtual machine found in the order of the names, the virtual machines are
+// retrieved once. It returns nil when none of them is found.
+func (c *DefaultClient) GetVirtualMachinePlacement(ctx context.Context, datacenterMOID string, names []string) (*VirtualMachinePlacement, error) {
+	ctx, cancel := c.apiContext(ctx)
+	defer cancel()
+	var vms []mo.VirtualMachine
+	properties := []string{"name", "resourcePool", "network", "runtime.host"}
+	if err := c.retrieveDatacenterObjects(ctx, datacenterMOID, []string{TypeVirtualMachine}, properties, &vms); err != nil {
+		return nil, errors.Wrap(err, "failed to get virtual machines")
+	}
+	byName := make(map[string]*mo.VirtualMachine, len(vms))
+	for i := range vms {
+		byName[vms[i].Name] = &vms[i]
+	}
+
+	for _, name := range names {
+		vm, ok := byName[name]
+		if !ok {
+			continue
+		}
+		placement := &VirtualMachinePlacement{}
+		if pool := vm.ResourcePool; pool != nil {
+			placement.ResourcePool = c.toManagementObject(ctx, *pool, models.VSphereManagementObjectResourceTypeRespool)
+		}
+		for _, network := range vm.Network {
+			if obj := c.toManagementObject(ctx, network, models.VSphereManagementObjectResourceTypeNetwork); obj != nil {
+				placement.Networks = append(placement.Networks, obj)
+			}
+		}
+		// Standalone hosts have a compute resource parent instead of a cluster.
+		if host := vm.Runtime.Host; host != nil {
+			var hostSystem mo.HostSystem
+			pc := property.DefaultCollector(c.vmomiClient.Client)
+			if err := pc.RetrieveOne(ctx, *host, []string{"parent"}, &hostSystem); err != nil {
+				return nil, errors.Wrap(err, "failed to get virtual machine host")
+			}
+			if parent := hostSystem.Parent; parent != nil && parent.Type == TypeCluster {
+				placement.Cluster = c.toManagementObject(ctx, *parent, models.VSphereManagementObjectResourceTypeCluster)
+			}
+		}
+		return placement, nil
+	}
+	return nil, nil
+}
+
+// toManagementObject returns the management object of the reference, or nil without a valid path
+func (c *DefaultClient) toManagementObject(ctx context.Context, ref types.ManagedObjectReference, resourceType string) *models.VSphereManagementObject {
+	objects := c.toManagementObjects(ctx, []mo.ManagedEntity{{ExtensibleManagedObject: mo.ExtensibleManagedObject{
+		Self: ref,
+	}}}, resourceType)
+	if len(objects) == 0 {
+		return nil
+	}
+	objects[0].Name = path.Base(objects[0].Path)
+	return objects[0]
+}
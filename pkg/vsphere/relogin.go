@@ -0,0 +1,52 @@
+package vsphere
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// reloginKey marks the context of the login calls, they are not retried
+type reloginKey struct{}
+
+// reloginRoundTripper logs in again and retries a SOAP call once when vCenter
+// rejects the session, so the cached sessions are not checked before every use.
+type reloginRoundTripper struct {
+	soap.RoundTripper
+
+	mu    sync.Mutex
+	login func(ctx context.Context) error
+}
+
+// setLogin sets the login replaying the credentials of the session
+func (rt *reloginRoundTripper) setLogin(login func(ctx context.Context) error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.login = login
+}
+
+// RoundTrip sends the call, the calls failing with NotAuthenticated are sent
+// again once logged in.
+func (rt *reloginRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	err := rt.RoundTripper.RoundTrip(ctx, req, res)
+	if err == nil || !isNotAuthenticated(err) || ctx.Value(reloginKey{}) != nil {
+		return err
+	}
+
+	rt.mu.Lock()
+	login := rt.login
+	if login != nil {
+		err = login(context.WithValue(ctx, reloginKey{}, true))
+	}
+	rt.mu.Unlock()
+	if login == nil || err != nil {
+		return err
+	}
+
+	// The decoded fault stays set on the response, the retry needs an empty one.
+	response := reflect.ValueOf(res).Elem()
+	response.Set(reflect.Zero(response.Type()))
+	return rt.RoundTripper.RoundTrip(ctx, req, res)
+}
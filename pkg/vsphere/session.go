@@ -0,0 +1,206 @@
+package vsphere
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ClientFactory returns logged in vCenter clients, Sessions is the default factory
+// and tests inject in-memory clients. The release function returned with a client
+// must be called once the caller is done with it.
+type ClientFactory interface {
+	Get(ctx context.Context, server, username, password string, tlsConfig TLSConfig) (Client, func(), error)
+}
+
+var _ ClientFactory = &Sessions{}
+
+// sessionKey identifies a cached session
+type sessionKey struct {
+	server   string
+	username string
+}
+
+// cachedSession holds the logged in client of a key, the lock serializes the logins of the key
+type cachedSession struct {
+	mu     sync.Mutex
+	client *sessionClient
+}
+
+// sessionClient is a logged in client and the number of callers holding it
+type sessionClient struct {
+	client Client
+
+	// fingerprint is the hash of the password and trust settings used to login,
+	// a change replaces the client.
+	fingerprint string
+
+	// holders is the number of callers which did not release the client, a replaced
+	// client is retired and logged out by its last holder.
+	holders int
+	retired bool
+}
+
+// Sessions caches the logged in vCenter clients by server and user, so reconciles
+// reuse a session instead of logging in. The session is not checked before being
+// returned, the clients of ConnectVCLogin log in again and retry a call rejected
+// once it expired. The replaced clients are logged out once released by all their
+// holders. Sessions is safe for concurrent use.
+type Sessions struct {
+	mu       sync.Mutex
+	sessions map[sessionKey]*cachedSession
+
+	// Timeouts bounds the calls of the session clients
+	Timeouts Timeouts
+
+	// login creates a logged in client, ConnectVCLogin by default
+	login func(ctx context.Context, server, username, password string, tlsConfig TLSConfig, timeouts Timeouts) (Client, error)
+}
+
+// NewSessions returns an empty session cache with the client timeouts
+func NewSessions(timeouts Timeouts) *Sessions {
+	return &Sessions{
+		sessions: map[sessionKey]*cachedSession{},
+		Timeouts: timeouts,
+		login:    ConnectVCLogin,
+	}
+}
+
+// Get returns a logged in client of the server and user and its release function,
+// the cached session is reused while the credentials are the same. The lock of the
+// key is only held while logging in, the calls of the clients do not wait on it.
+func (s *Sessions) Get(ctx context.Context, server, username, password string, tlsConfig TLSConfig) (Client, func(), error) {
+	entry := s.entry(sessionKey{server: server, username: username})
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	fingerprint := sessionFingerprint(password, tlsConfig)
+	if current := entry.client; current != nil {
+		if current.fingerprint == fingerprint {
+			return current.client, s.lease(current), nil
+		}
+		// The credentials changed.
+		entry.client = nil
+		s.retire(ctx, current)
+	}
+
+	login := s.login
+	if login == nil {
+		login = ConnectVCLogin
+	}
+	client, err := login(ctx, server, username, password, tlsConfig, s.Timeouts)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry.client = &sessionClient{client: client, fingerprint: fingerprint}
+	return client, s.lease(entry.client), nil
+}
+
+// lease holds the client until the returned function is called, a retired client
+// is logged out by its last holder.
+func (s *Sessions) lease(c *sessionClient) func() {
+	s.mu.Lock()
+	c.holders++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			c.holders--
+			logout := c.retired && c.holders == 0
+			s.mu.Unlock()
+			if logout {
+				// The logout is best effort, the session expires anyway.
+				_ = c.client.Logout(context.Background())
+			}
+		})
+	}
+}
+
+// retire marks a replaced client, it is logged out now when no caller holds it
+func (s *Sessions) retire(ctx context.Context, c *sessionClient) {
+	s.mu.Lock()
+	c.retired = true
+	logout := c.holders == 0
+	s.mu.Unlock()
+	if logout {
+		_ = c.client.Logout(ctx)
+	}
+}
+
+// entry returns the session of the key, creating it when missing
+func (s *Sessions) entry(key sessionKey) *cachedSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = map[sessionKey]*cachedSession{}
+	}
+	entry, ok := s.sessions[key]
+	if !ok {
+		entry = &cachedSession{}
+		s.sessions[key] = entry
+	}
+	return entry
+}
+
+// Logout ends and removes every cached session
+func (s *Sessions) Logout(ctx context.Context) error {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = map[sessionKey]*cachedSession{}
+	s.mu.Unlock()
+
+	var errs []error
+	for key, entry := range sessions {
+		entry.mu.Lock()
+		if entry.client != nil {
+			if err := entry.client.client.Logout(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s@%s: %v", key.username, key.server, err))
+			}
+			entry.client = nil
+		}
+		entry.mu.Unlock()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to logout the vCenter sessions: %v", errs)
+	}
+	return nil
+}
+
+// Start waits for the manager to stop and logs out the sessions, it implements
+// the controller-runtime Runnable interface.
+func (s *Sessions) Start(ctx context.Context) error {
+	<-ctx.Done()
+	if err := s.Logout(context.Background()); err != nil {
+		log.FromContext(ctx).Error(err, "unable to logout from vCenter")
+	}
+	return nil
+}
+
+// NeedLeaderElection returns false, the sessions of every replica are logged out
+func (s *Sessions) NeedLeaderElection() bool {
+	return false
+}
+
+// isNotAuthenticated returns true when the vCenter rejected the session
+func isNotAuthenticated(err error) bool {
+	if !soap.IsSoapFault(err) {
+		return false
+	}
+	_, ok := soap.ToSoapFault(err).VimFault().(types.NotAuthenticated)
+	return ok
+}
+
+// sessionFingerprint hashes the password and trust settings of a login
+func sessionFingerprint(password string, tlsConfig TLSConfig) string {
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\x00%s\x00%t\x00", password, tlsConfig.Thumbprint, tlsConfig.Insecure)
+	hasher.Write(tlsConfig.CABundle)
+	return fmt.Sprintf("%x", hasher.Sum(nil))
+}
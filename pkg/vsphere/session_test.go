@@ -0,0 +1,148 @@
+package vsphere
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("vCenter sessions", func() {
+	var (
+		ctx      = context.Background()
+		sessions *Sessions
+		logins   int32
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&logins, 0)
+		sessions = NewSessions(DefaultTimeouts)
+		sessions.login = func(ctx context.Context, server, username, password string, tlsConfig TLSConfig, timeouts Timeouts) (Client, error) {
+			atomic.AddInt32(&logins, 1)
+			return ConnectVCLogin(ctx, server, username, password, tlsConfig, timeouts)
+		}
+	})
+
+	AfterEach(func() {
+		Expect(sessions.Logout(ctx)).To(Succeed())
+	})
+
+	It("should reuse the active session", func() {
+		first, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		release()
+		second, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		release()
+		Expect(second).To(BeIdenticalTo(first))
+		Expect(atomic.LoadInt32(&logins)).To(BeEquivalentTo(1))
+	})
+
+	It("should login again the calls rejected once the session expired", func() {
+		first, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		release()
+		Expect(first.(*DefaultClient).vmomiClient.SessionManager.Logout(ctx)).To(Succeed())
+
+		second, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		defer release()
+		Expect(second).To(BeIdenticalTo(first))
+		_, err = second.GetDatacenters(ctx)
+		Expect(err).To(BeNil())
+		Expect(second.CheckUserSessionActive(ctx)).To(BeTrue())
+		Expect(atomic.LoadInt32(&logins)).To(BeEquivalentTo(1))
+	})
+
+	It("should login again when the password changed", func() {
+		first, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		release()
+		second, release, err := sessions.Get(ctx, vcServer, username, password+"-rotated", trust)
+		Expect(err).To(BeNil())
+		defer release()
+		Expect(atomic.LoadInt32(&logins)).To(BeEquivalentTo(2))
+
+		// The replaced session is not held, it is logged out right away.
+		Expect(second).NotTo(BeIdenticalTo(first))
+		Expect(first.CheckUserSessionActive(ctx)).To(BeFalse())
+	})
+
+	It("should logout a replaced session once released by its holders", func() {
+		first, releaseFirst, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		_, releaseSecond, err := sessions.Get(ctx, vcServer, username, password+"-rotated", trust)
+		Expect(err).To(BeNil())
+		defer releaseSecond()
+
+		Expect(first.CheckUserSessionActive(ctx)).To(BeTrue())
+		releaseFirst()
+		releaseFirst()
+		Expect(first.CheckUserSessionActive(ctx)).To(BeFalse())
+	})
+
+	It("should not check the session before returning it", func() {
+		var checks int32
+		sessions.login = func(ctx context.Context, server, username, password string, tlsConfig TLSConfig, timeouts Timeouts) (Client, error) {
+			client, err := ConnectVCLogin(ctx, server, username, password, tlsConfig, timeouts)
+			return &countingClient{Client: client, checks: &checks}, err
+		}
+		for i := 0; i < 3; i++ {
+			_, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+			Expect(err).To(BeNil())
+			release()
+		}
+		Expect(atomic.LoadInt32(&checks)).To(BeZero())
+	})
+
+	It("should share a session between concurrent reconciles", func() {
+		var (
+			wg      sync.WaitGroup
+			clients = make([]Client, 10)
+		)
+		for i := range clients {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				client, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+				Expect(err).To(BeNil())
+				release()
+				clients[i] = client
+			}(i)
+		}
+		wg.Wait()
+		for _, client := range clients {
+			Expect(client).To(BeIdenticalTo(clients[0]))
+		}
+		Expect(atomic.LoadInt32(&logins)).To(BeEquivalentTo(1))
+	})
+
+	It("should logout the sessions on shutdown", func() {
+		client, release, err := sessions.Get(ctx, vcServer, username, password, trust)
+		Expect(err).To(BeNil())
+		defer release()
+
+		stop, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() { done <- sessions.Start(stop) }()
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+
+		active, _ := client.CheckUserSessionActive(ctx)
+		Expect(active).To(BeFalse())
+	})
+})
+
+// countingClient counts the session checks
+type countingClient struct {
+	Client
+	checks *int32
+}
+
+func (c *countingClient) CheckUserSessionActive(ctx context.Context) (bool, error) {
+	atomic.AddInt32(c.checks, 1)
+	return c.Client.CheckUserSessionActive(ctx)
+}
@@ -0,0 +1,36 @@
+package vsphere
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds the vCenter calls on top of the caller deadline, a zero duration
+// keeps the caller deadline only.
+type Timeouts struct {
+	// API bounds each Client method call
+	API time.Duration
+
+	// Task bounds the wait for a vCenter task, like a datastore search
+	Task time.Duration
+}
+
+// DefaultTimeouts are used when no timeouts are configured
+var DefaultTimeouts = Timeouts{
+	API:  time.Minute,
+	Task: 5 * time.Minute,
+}
+
+// withTimeout returns the context bounded by the timeout
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// APIContext returns the context bounded by the API timeout, for the vCenter calls
+// made outside of a Client like PinnedCertificate.
+func (t Timeouts) APIContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, t.API)
+}
@@ -0,0 +1,67 @@
+package vsphere
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("vCenter timeouts", func() {
+	var (
+		ctx    = context.Background()
+		client Client
+	)
+
+	BeforeEach(func() {
+		var err error
+		client, err = ConnectVCLogin(ctx, vcServer, username, password, trust, Timeouts{API: 200 * time.Millisecond})
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(client.Logout(ctx)).To(Succeed())
+	})
+
+	It("should stop the login once the API timeout expires", func() {
+		// The listener accepts the connections and never answers, like a hung vCenter.
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		start := time.Now()
+		_, err = ConnectVCLogin(ctx, "http://"+listener.Addr().String(), username, password, trust,
+			Timeouts{API: 200 * time.Millisecond})
+		Expect(err).To(MatchError(ContainSubstring("deadline exceeded")))
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+
+	It("should stop a call when the caller context is done", func() {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := client.CheckUserSessionActive(cancelled)
+		Expect(err).To(MatchError(ContainSubstring("context canceled")))
+	})
+
+	It("should not bound the calls without timeouts", func() {
+		unbounded, err := ConnectVCLogin(ctx, vcServer, username, password, trust, Timeouts{})
+		Expect(err).To(BeNil())
+		defer unbounded.Logout(ctx)
+
+		datacenters, err := unbounded.GetDatacenters(ctx)
+		Expect(err).To(BeNil())
+		Expect(datacenters).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,113 @@
+package vsphere
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// TLSConfig holds the trust settings of the vCenter connections, the certificate is
+// verified with the system roots, the CA bundle or the thumbprint unless Insecure is set.
+type TLSConfig struct {
+	// Thumbprint is the SHA-1 thumbprint of the vCenter certificate
+	Thumbprint string
+
+	// CABundle holds the PEM certificates trusted for the vCenter
+	CABundle []byte
+
+	// Insecure skips the certificate verification
+	Insecure bool
+}
+
+// configure sets the trust settings on the SOAP client of the host
+func (t TLSConfig) configure(soapClient *soap.Client, host string) error {
+	if t.Insecure {
+		return nil
+	}
+	if t.Thumbprint != "" {
+		soapClient.SetThumbprint(host, t.Thumbprint)
+
+		// The SOAP client only falls back on the thumbprint for the unwrapped x509 errors,
+		// the certificate is pinned by the TLS config shared with the service clients.
+		config := soapClient.DefaultTransport().TLSClientConfig
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyThumbprint(t.Thumbprint)
+		return nil
+	}
+	if len(t.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(t.CABundle) {
+			return fmt.Errorf("the CA bundle has no valid PEM certificate")
+		}
+		soapClient.DefaultTransport().TLSClientConfig.RootCAs = pool
+	}
+	return nil
+}
+
+// PinnedCertificate returns the PEM certificate presented by the vCenter, it must match
+// the thumbprint. Clients without thumbprint support can trust it as a CA bundle.
+func PinnedCertificate(ctx context.Context, server, thumbprint string) ([]byte, error) {
+	certificate, err := pinnedCertificate(ctx, server, thumbprint)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}), nil
+}
+
+// VerifyPinnedHostname checks the certificate matching the thumbprint is valid for the
+// vCenter host name. The thumbprint pins the certificate without checking the name,
+// the clients trusting it as a CA bundle verify it.
+func VerifyPinnedHostname(ctx context.Context, server, thumbprint string) error {
+	certificate, err := pinnedCertificate(ctx, server, thumbprint)
+	if err != nil {
+		return err
+	}
+	host := server
+	if h, _, err := net.SplitHostPort(server); err == nil {
+		host = h
+	}
+	return certificate.VerifyHostname(host)
+}
+
+// pinnedCertificate returns the certificate presented by the vCenter matching the thumbprint
+func pinnedCertificate(ctx context.Context, server, thumbprint string) (*x509.Certificate, error) {
+	address := server
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "443")
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verifyThumbprint(thumbprint),
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("vCenter %s: %v", server, err)
+	}
+	defer conn.Close()
+
+	return conn.(*tls.Conn).ConnectionState().PeerCertificates[0], nil
+}
+
+// verifyThumbprint returns a TLS verification matching the peer certificate with the thumbprint
+func verifyThumbprint(thumbprint string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no certificate presented")
+		}
+		certificate, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+		if actual := soap.ThumbprintSHA1(certificate); !strings.EqualFold(actual, thumbprint) {
+			return fmt.Errorf("certificate thumbprint %s does not match %s", actual, thumbprint)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package vsphere
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+var _ = Describe("vCenter TLS", func() {
+	var (
+		ctx        = context.Background()
+		thumbprint string
+	)
+
+	BeforeEach(func() {
+		thumbprint = soap.ThumbprintSHA1(server.Certificate())
+	})
+
+	// connect logs in to vcsim with the trust settings and logs out after the spec
+	connect := func(host string, tlsConfig TLSConfig) error {
+		client, err := ConnectVCLogin(ctx, host, username, password, tlsConfig, DefaultTimeouts)
+		if err == nil {
+			DeferCleanup(func() {
+				Expect(client.Logout(ctx)).To(Succeed())
+			})
+		}
+		return err
+	}
+
+	// localhost is not a name of the vcsim certificate, issued for 127.0.0.1
+	localhost := func() string {
+		_, port, err := net.SplitHostPort(vcServer)
+		Expect(err).To(BeNil())
+		return net.JoinHostPort("localhost", port)
+	}
+
+	It("should verify the certificate by default", func() {
+		err := connect(vcServer, TLSConfig{})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("certificate"))
+	})
+
+	It("should trust the CA bundle", func() {
+		Expect(connect(vcServer, trust)).To(Succeed())
+	})
+
+	It("should verify the host name with the CA bundle", func() {
+		err := connect(localhost(), trust)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("localhost"))
+	})
+
+	It("should reject a CA bundle without certificates", func() {
+		err := connect(vcServer, TLSConfig{CABundle: []byte("not a certificate")})
+		Expect(err).To(MatchError(ContainSubstring("no valid PEM certificate")))
+	})
+
+	It("should trust the certificate matching the thumbprint", func() {
+		Expect(connect(vcServer, TLSConfig{Thumbprint: thumbprint})).To(Succeed())
+	})
+
+	It("should reject a wrong thumbprint", func() {
+		err := connect(vcServer, TLSConfig{Thumbprint: "00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33"})
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("does not match"))
+	})
+
+	It("should skip the verification when insecure", func() {
+		Expect(connect(localhost(), TLSConfig{Insecure: true})).To(Succeed())
+	})
+
+	Describe("pinning the certificate", func() {
+		It("should return the certificate matching the thumbprint", func() {
+			data, err := PinnedCertificate(ctx, vcServer, thumbprint)
+			Expect(err).To(BeNil())
+			block, _ := pem.Decode(data)
+			Expect(block).NotTo(BeNil())
+			Expect(block.Bytes).To(Equal(server.Certificate().Raw))
+
+			_, err = PinnedCertificate(ctx, vcServer, "00:11")
+			Expect(err).To(MatchError(ContainSubstring("does not match")))
+		})
+
+		It("should verify the host name the thumbprint does not check", func() {
+			Expect(connect(localhost(), TLSConfig{Thumbprint: thumbprint})).To(Succeed())
+
+			Expect(VerifyPinnedHostname(ctx, vcServer, thumbprint)).To(Succeed())
+			err := VerifyPinnedHostname(ctx, localhost(), thumbprint)
+			Expect(err).To(MatchError(ContainSubstring("localhost")))
+		})
+	})
+})
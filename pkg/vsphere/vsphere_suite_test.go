@@ -0,0 +1,46 @@
+package vsphere
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/simulator"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+)
+
+var (
+	model    *simulator.Model
+	server   *simulator.Server
+	vcServer string
+	username string
+	password string
+
+	// trust verifies the certificate of the vcsim TLS server
+	trust TLSConfig
+)
+
+func TestVSphere(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "vSphere Client Suite")
+}
+
+var _ = BeforeSuite(func() {
+	model = simulator.VPX()
+	Expect(model.Create()).To(Succeed())
+	model.Service.RegisterEndpoints = true
+	model.Service.TLS = new(tls.Config)
+	server = model.Service.NewServer()
+
+	vcServer = server.URL.Host
+	trust = TLSConfig{CABundle: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})}
+	username = simulator.DefaultLogin.Username()
+	password, _ = simulator.DefaultLogin.Password()
+})
+
+var _ = AfterSuite(func() {
+	server.Close()
+	model.Remove()
+})
@@ -0,0 +1,118 @@
+package vsphere
+
+import (
+	"context"
+
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// watchedProperties are the virtual machine properties reported by WatchVirtualMachines
+var watchedProperties = []string{"name", "config.template", "config.vAppConfig"}
+
+// VirtualMachineUpdate is a change of a template, or of a virtual machine that was one
+type VirtualMachineUpdate struct {
+	Moid     string
+	Name     string
+	Template bool
+
+	// Removed is true when the virtual machine was destroyed or left the datacenter
+	Removed bool
+}
+
+// WatchVirtualMachines keeps a WaitForUpdatesEx subscription on the virtual machines of
+// the datacenter and calls onUpdates with the template changes, the existing virtual
+// machines are not reported. It blocks until the context is done or the session drops.
+func (c *DefaultClient) WatchVirtualMachines(ctx context.Context, datacenterMOID string, onUpdates func([]VirtualMachineUpdate)) error {
+	apiCtx, cancel := c.apiContext(ctx)
+	defer cancel()
+	view, err := c.createContainerView(apiCtx, TypeDatacenter+":"+datacenterMOID, []string{TypeVirtualMachine})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// The context may be done, the view is destroyed with a fresh one.
+		ctx, cancel := c.apiContext(context.Background())
+		defer cancel()
+		_ = view.Destroy(ctx)
+	}()
+
+	filter := &property.WaitFilter{}
+	filter.Spec.ObjectSet = []types.ObjectSpec{{
+		Obj:  view.Reference(),
+		Skip: types.NewBool(true),
+		SelectSet: []types.BaseSelectionSpec{
+			&types.TraversalSpec{Type: view.Reference().Type, Path: "view"},
+		},
+	}}
+	filter.Spec.PropSet = []types.PropertySpec{{Type: TypeVirtualMachine, PathSet: watchedProperties}}
+
+	tracker := newTemplateTracker()
+	err = property.WaitForUpdates(ctx, property.DefaultCollector(c.vmomiClient.Client), filter, func(objects []types.ObjectUpdate) bool {
+		// WaitForUpdates sets the Truncated flag of the update set before the callback.
+		if updates := tracker.apply(objects, filter.Truncated); len(updates) > 0 {
+			onUpdates(updates)
+		}
+		return false
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// templateTracker keeps the state of the watched virtual machines to report the
+// template changes.
+type templateTracker struct {
+	known map[string]VirtualMachineUpdate
+	// initial is true until the existing virtual machines are fully listed, vCenter
+	// may split them across several truncated update sets.
+	initial bool
+}
+
+func newTemplateTracker() *templateTracker {
+	return &templateTracker{known: map[string]VirtualMachineUpdate{}, initial: true}
+}
+
+// apply records the object updates of an update set and returns the template changes,
+// none until the last update set of the existing virtual machines is received.
+func (t *templateTracker) apply(objects []types.ObjectUpdate, truncated bool) []VirtualMachineUpdate {
+	var updates []VirtualMachineUpdate
+	for _, object := range objects {
+		previous, ok := t.known[object.Obj.Value]
+		update := applyObjectUpdate(previous, object)
+		if update.Removed {
+			delete(t.known, update.Moid)
+		} else {
+			t.known[update.Moid] = update
+		}
+		if !t.initial && (update.Template || (ok && previous.Template)) {
+			updates = append(updates, update)
+		}
+	}
+	if !truncated {
+		t.initial = false
+	}
+	return updates
+}
+
+// applyObjectUpdate returns the virtual machine state after the property collector update
+func applyObjectUpdate(vm VirtualMachineUpdate, object types.ObjectUpdate) VirtualMachineUpdate {
+	vm.Moid = object.Obj.Value
+	if object.Kind == types.ObjectUpdateKindLeave {
+		vm.Removed = true
+		return vm
+	}
+	for _, change := range object.ChangeSet {
+		switch change.Name {
+		case "name":
+			if name, ok := change.Val.(string); ok {
+				vm.Name = name
+			}
+		case "config.template":
+			template, ok := change.Val.(bool)
+			vm.Template = ok && template
+		}
+	}
+	return vm
+}
@@ -0,0 +1,41 @@
+package vsphere
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+var _ = Describe("template tracker", func() {
+	// template returns the update of a virtual machine entering the view as a template
+	template := func(moid, name string) types.ObjectUpdate {
+		return types.ObjectUpdate{
+			Kind: types.ObjectUpdateKindEnter,
+			Obj:  types.ManagedObjectReference{Type: TypeVirtualMachine, Value: moid},
+			ChangeSet: []types.PropertyChange{
+				{Name: "name", Op: types.PropertyChangeOpAssign, Val: name},
+				{Name: "config.template", Op: types.PropertyChangeOpAssign, Val: true},
+			},
+		}
+	}
+
+	It("should skip the existing templates split across truncated update sets", func() {
+		tracker := newTemplateTracker()
+		Expect(tracker.apply([]types.ObjectUpdate{template("vm-1", "windows-2019")}, true)).To(BeEmpty())
+		Expect(tracker.apply([]types.ObjectUpdate{template("vm-2", "windows-2022")}, false)).To(BeEmpty())
+
+		Expect(tracker.apply([]types.ObjectUpdate{template("vm-3", "ubuntu-2004")}, false)).To(Equal([]VirtualMachineUpdate{
+			{Moid: "vm-3", Name: "ubuntu-2004", Template: true},
+		}))
+	})
+
+	It("should report the removal of an existing template", func() {
+		tracker := newTemplateTracker()
+		Expect(tracker.apply([]types.ObjectUpdate{template("vm-1", "windows-2019")}, false)).To(BeEmpty())
+
+		leave := types.ObjectUpdate{Kind: types.ObjectUpdateKindLeave, Obj: types.ManagedObjectReference{Type: TypeVirtualMachine, Value: "vm-1"}}
+		Expect(tracker.apply([]types.ObjectUpdate{leave}, false)).To(Equal([]VirtualMachineUpdate{
+			{Moid: "vm-1", Name: "windows-2019", Template: true, Removed: true},
+		}))
+	})
+})
@@ -0,0 +1,68 @@
+package windows
+
+import (
+	"fmt"
+)
+
+const (
+	DefaultWindowsVersion = "2019"
+
+	EditionCore    = "core"
+	EditionDesktop = "desktop"
+)
+
+// OSTarget holds the image-builder target for a Windows Server version and edition
+type OSTarget struct {
+	Version    string
+	Edition    string
+	MakeTarget string
+	ImageIndex string
+}
+
+// makeTargets maps the Windows Server version to the image-builder make target.
+var makeTargets = map[string]string{
+	"2019": "build-node-ova-vsphere-windows-2019",
+	"2022": "build-node-ova-vsphere-windows-2022",
+}
+
+// imageIndexes maps the edition to the Datacenter image index inside the ISO.
+var imageIndexes = map[string]string{
+	EditionCore:    "3",
+	EditionDesktop: "4",
+}
+
+// DefaultMakeTarget returns the image-builder make target of the default Windows version
+func DefaultMakeTarget() string {
+	return makeTargets[DefaultWindowsVersion]
+}
+
+// GetOSTarget returns the build target for the Windows version and edition
+func GetOSTarget(version, edition string) (*OSTarget, error) {
+	makeTarget, ok := makeTargets[version]
+	if !ok {
+		return nil, fmt.Errorf("windows version %q is not supported", version)
+	}
+	imageIndex, ok := imageIndexes[edition]
+	if !ok {
+		return nil, fmt.Errorf("windows edition %q is not supported", edition)
+	}
+	return &OSTarget{
+		Version:    version,
+		Edition:    edition,
+		MakeTarget: makeTarget,
+		ImageIndex: imageIndex,
+	}, nil
+}
+
+// BuildName returns the image-builder build name, Core keeps the upstream default.
+func (t *OSTarget) BuildName() string {
+	if t.Edition == EditionCore {
+		return fmt.Sprintf("windows-%s", t.Version)
+	}
+	return fmt.Sprintf("windows-%s-%s", t.Version, t.Edition)
+}
+
+// TemplateName returns the name of the vSphere template produced by the build
+func (t *OSTarget) TemplateName(kubernetesVersion string) string {
+	return fmt.Sprintf("%s-kube-%s", t.BuildName(), kubernetesVersion)
+}
@@ -0,0 +1,37 @@
+package windows_test
+
+import (
+	"github.com/knabben/tkw/pkg/windows"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Windows build targets", func() {
+	DescribeTable("selecting the version and edition",
+		func(version, edition, makeTarget, imageIndex, templateName string) {
+			target, err := windows.GetOSTarget(version, edition)
+			Expect(err).To(BeNil())
+			Expect(target.MakeTarget).To(Equal(makeTarget))
+			Expect(target.ImageIndex).To(Equal(imageIndex))
+			Expect(target.TemplateName("v1.23.8")).To(Equal(templateName))
+		},
+		Entry("2019 core", "2019", windows.EditionCore,
+			"build-node-ova-vsphere-windows-2019", "3", "windows-2019-kube-v1.23.8"),
+		Entry("2019 desktop", "2019", windows.EditionDesktop,
+			"build-node-ova-vsphere-windows-2019", "4", "windows-2019-desktop-kube-v1.23.8"),
+		Entry("2022 core", "2022", windows.EditionCore,
+			"build-node-ova-vsphere-windows-2022", "3", "windows-2022-kube-v1.23.8"),
+		Entry("2022 desktop", "2022", windows.EditionDesktop,
+			"build-node-ova-vsphere-windows-2022", "4", "windows-2022-desktop-kube-v1.23.8"),
+	)
+
+	It("should reject an unknown version", func() {
+		_, err := windows.GetOSTarget("2016", windows.EditionCore)
+		Expect(err).To(MatchError(ContainSubstring(`windows version "2016" is not supported`)))
+	})
+
+	It("should reject an unknown edition", func() {
+		_, err := windows.GetOSTarget("2019", "datacenter")
+		Expect(err).To(MatchError(ContainSubstring(`windows edition "datacenter" is not supported`)))
+	})
+})
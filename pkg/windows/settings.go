@@ -6,12 +6,18 @@ import (
 	"github.com/knabben/tkw/api/v1alpha1"
 	"github.com/knabben/tkw/pkg/config"
 	"github.com/knabben/tkw/pkg/vsphere"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // WindowsConfiguration holds image-builder configuration parameters
 type WindowsConfiguration struct {
+	BuildName                            string `json:"build_name"`
+	WindowsImageIndex                    string `json:"windows_image_index"`
 	UnattendTimezone                     string `json:"unattend_timezone"`
 	WindowsUpdatesCategories             string `json:"windows_updates_categories"`
 	WindowUpdatesKbs                     string `json:"windows_updates_kbs"`
@@ -51,60 +57,64 @@ type WindowsConfiguration struct {
 type WindowsSettings struct {
 	OSImagePath          string
 	VMToolsPath          string
-	ServiceName          string
-	ServiceNamespace     string
-	ServicePort          int32
+	BundleURL            string
+	Release              *KubernetesRelease
+	Target               *OSTarget
 	WindowsConfiguration *WindowsConfiguration
 }
 
-func NewWindowsSettings(osp, vmp, svcName, svcNS string, svcPort int32, img *v1alpha1.OSImage) *WindowsSettings {
+func NewWindowsSettings(osp, vmp, bundleURL string, release *KubernetesRelease, target *OSTarget, img *v1alpha1.OSImage) *WindowsSettings {
+	placement := img.Status.Placement
+	if placement == nil {
+		placement = &v1alpha1.OSImagePlacement{}
+	}
 	return &WindowsSettings{
-		OSImagePath:      osp,
-		VMToolsPath:      vmp,
-		ServiceName:      svcName,
-		ServicePort:      svcPort,
-		ServiceNamespace: svcNS,
+		OSImagePath: osp,
+		VMToolsPath: vmp,
+		BundleURL:   bundleURL,
+		Release:     release,
+		Target:      target,
 		WindowsConfiguration: &WindowsConfiguration{
-			Folder:       img.Spec.VSphereFolder,
-			Datastore:    img.Spec.VSphereDataStore,
-			Network:      img.Spec.VSphereNetwork,
-			ResourcePool: img.Spec.VSphereResourcePool,
-			Cluster:      img.Spec.VSphereCluster,
+			Folder:       placement.Folder,
+			Datastore:    placement.Datastore,
+			Network:      placement.Network,
+			ResourcePool: placement.ResourcePool,
+			Cluster:      placement.Cluster,
 		},
 	}
 }
 
-// GenerateJSONConfig renders the full Window.WindowsConfiguration. settings in JSON
-func (w *WindowsSettings) GenerateJSONConfig(mapper *config.Mapper) ([]byte, error) {
+// GenerateJSONConfig renders the full Window.WindowsConfiguration. settings in JSON,
+// the precedence from lowest to highest is: controller defaults, values discovered
+// from the management cluster and spec, and the overrides in the order given.
+// Overrides can set packer variables not modeled by WindowsConfiguration.
+func (w *WindowsSettings) GenerateJSONConfig(mapper *config.Mapper, overrides ...map[string]string) ([]byte, error) {
 	baseUrl := w.BaseBurritoURL()
 
-	w.WindowsConfiguration.OsIsoPath = generateIsoPath(w.WindowsConfiguration.Datastore, filepath.Base(w.OSImagePath))
-	w.WindowsConfiguration.VmtoolsIsoPath = generateIsoPath(w.WindowsConfiguration.Datastore, filepath.Base(w.VMToolsPath))
+	w.WindowsConfiguration.OsIsoPath = generateIsoPath(ISOLocation(w.OSImagePath, w.WindowsConfiguration.Datastore))
+	w.WindowsConfiguration.VmtoolsIsoPath = generateIsoPath(ISOLocation(w.VMToolsPath, w.WindowsConfiguration.Datastore))
 
 	w.WindowsConfiguration.Password = mapper.Get(vsphere.VspherePassword)
 	w.WindowsConfiguration.Username = mapper.Get(vsphere.VsphereUsername)
 	w.WindowsConfiguration.VcenterServer = mapper.Get(vsphere.VsphereServer)
 	w.WindowsConfiguration.Datacenter = mapper.Get(vsphere.VsphereDataCenter)
 
+	w.WindowsConfiguration.BuildName = w.Target.BuildName()
+	w.WindowsConfiguration.WindowsImageIndex = w.Target.ImageIndex
+
 	w.WindowsConfiguration.Runtime = "containerd"
 	w.WindowsConfiguration.ConvertToTemplate = "true"
 
-	// todo(knabben): pass it via parameters on spec
-	kubernetesVersion := "v1.23.8"
 	w.WindowsConfiguration.WindowsUpdatesCategories = "CriticalUpdates SecurityUpdates UpdateRollups"
 	w.WindowsConfiguration.UnattendTimezone = "GMT Standard Time"
-	w.WindowsConfiguration.KubernetesSemver = kubernetesVersion
+	w.WindowsConfiguration.KubernetesSemver = w.Release.KubernetesVersion
 
-	const (
-		containerdFile = "cri-containerd-v1.6.6+vmware.2.windows-amd64.tar"
-		containerdHash = "a5348e2e7cc63194c2bb4575dd3c414a26c829380e72a81c3dc2d12454f67fcd"
-		antreaFile     = "antrea-windows-advanced.zip"
-	)
+	const antreaFile = "antrea-windows-advanced.zip"
 
-	w.WindowsConfiguration.ContainerdURL = fmt.Sprintf("%s/files/containerd/%s", baseUrl, containerdFile)
-	w.WindowsConfiguration.ContainerdSha256Windows = containerdHash
+	w.WindowsConfiguration.ContainerdURL = fmt.Sprintf("%s/files/containerd/%s", baseUrl, w.Release.ContainerdFile)
+	w.WindowsConfiguration.ContainerdSha256Windows = w.Release.ContainerdHash
 
-	w.WindowsConfiguration.InsecureConnection = "true"
+	w.WindowsConfiguration.InsecureConnection = strconv.FormatBool(mapper.Get(vsphere.VsphereInsecure) == "true")
 	w.WindowsConfiguration.LinkedClone = "false"
 	w.WindowsConfiguration.DisableHypervisor = "false"
 	w.WindowsConfiguration.CreateSnapshot = "false"
@@ -118,16 +128,69 @@ func (w *WindowsSettings) GenerateJSONConfig(mapper *config.Mapper) ([]byte, err
 	w.WindowsConfiguration.AdditionalExecutablesDestinationPath = "c:/k/antrea/"
 	w.WindowsConfiguration.AdditionalExecutablesList = fmt.Sprintf("%s/files/antrea-windows/%s", baseUrl, antreaFile)
 
-	return json.Marshal(w.WindowsConfiguration)
+	return mergeVariables(w.WindowsConfiguration, overrides...)
+}
+
+// reservedVariables can not be overridden: the vCenter and its credentials come from
+// the credentials the controller checks and lists the templates with, and the
+// controller finds the built template by its build_name.
+var reservedVariables = []string{"build_name", "vcenter_server", "username", "password"}
+
+// ReservedVariables returns the reserved packer variables set by the overrides, sorted
+func ReservedVariables(overrides ...map[string]string) []string {
+	var reserved []string
+	for _, key := range reservedVariables {
+		for _, override := range overrides {
+			if _, ok := override[key]; ok {
+				reserved = append(reserved, key)
+				break
+			}
+		}
+	}
+	sort.Strings(reserved)
+	return reserved
+}
+
+// mergeVariables flattens the configuration into packer variables and applies
+// the overrides, the last one wins.
+func mergeVariables(configuration *WindowsConfiguration, overrides ...map[string]string) ([]byte, error) {
+	data, err := json.Marshal(configuration)
+	if err != nil {
+		return nil, err
+	}
+	variables := map[string]string{}
+	if err := json.Unmarshal(data, &variables); err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		for key, value := range override {
+			variables[key] = value
+		}
+	}
+	return json.Marshal(variables)
 }
 
-// BaseBurritoURL returns the service endpoint for assets download
+// BaseBurritoURL returns the resource bundle endpoint for assets download, it
+// must be reachable from the Packer VM running in vSphere.
 func (w *WindowsSettings) BaseBurritoURL() string {
-	return fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", w.ServiceName, w.ServiceNamespace, w.ServicePort)
+	return strings.TrimSuffix(w.BundleURL, "/")
+}
+
+// DatastorePathRegex matches a vSphere datastore path, "[datastore] folder/file.iso"
+var DatastorePathRegex = regexp.MustCompile(`^\[([^\[\]]+)\] (\S.*)$`)
+
+// ISOLocation returns the datastore holding an ISO and its path relative to the
+// datastore root. Datastore paths keep their datastore and folder, other paths
+// are looked up by file name on the root of the given datastore.
+func ISOLocation(isoPath, datastore string) (string, string) {
+	if m := DatastorePathRegex.FindStringSubmatch(isoPath); m != nil {
+		return m[1], strings.TrimPrefix(path.Clean("/"+m[2]), "/")
+	}
+	return datastore, filepath.Base(isoPath)
 }
 
 // generateISOPath returns the full path for file access
-// ie [datastore1] iso/VMw.WindowsConfiguration.re-tools-windows-11.3.5-18557794.iso)
+// ie [datastore1] ./iso/vmware-tools-windows-11.3.5-18557794.iso
 func generateIsoPath(datastore, path string) string {
 	ds := strings.Split(datastore, "/")
 	return fmt.Sprintf("[%s] ./%s", ds[len(ds)-1], path)
@@ -0,0 +1,95 @@
+package windows_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/knabben/tkw/api/v1alpha1"
+	"github.com/knabben/tkw/pkg/config"
+	"github.com/knabben/tkw/pkg/vsphere"
+	"github.com/knabben/tkw/pkg/windows"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestWindows(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Windows Settings Tests")
+}
+
+func renderConfig(img *v1alpha1.OSImage, overrides ...map[string]string) map[string]string {
+	release, err := windows.GetKubernetesRelease(img.Spec.KubernetesVersion)
+	Expect(err).To(BeNil())
+	target, err := windows.GetOSTarget(img.Spec.WindowsVersion, img.Spec.WindowsEdition)
+	Expect(err).To(BeNil())
+
+	cmap := &config.Mapper{}
+	cmap.Set(vsphere.VsphereServer, "10.0.0.1")
+	cmap.Set(vsphere.VsphereDataCenter, "/dc0")
+
+	data, err := windows.NewWindowsSettings(
+		img.Spec.WindowsISOPath, img.Spec.VMToolsPath, "http://10.0.0.10:30008/", release, target, img,
+	).GenerateJSONConfig(cmap, overrides...)
+	Expect(err).To(BeNil())
+
+	variables := map[string]string{}
+	Expect(json.Unmarshal(data, &variables)).To(Succeed())
+	return variables
+}
+
+var _ = Describe("Windows settings", func() {
+	var img *v1alpha1.OSImage
+
+	BeforeEach(func() {
+		img = &v1alpha1.OSImage{Spec: v1alpha1.OSImageSpec{
+			WindowsISOPath:    "./isos/win.iso",
+			VMToolsPath:       "./isos/vmtools.iso",
+			KubernetesVersion: "v1.23.8",
+			WindowsVersion:    "2019",
+			WindowsEdition:    windows.EditionCore,
+		}, Status: v1alpha1.OSImageStatus{
+			Placement: &v1alpha1.OSImagePlacement{Datastore: "/dc0/datastore/sharedVmfs-0"},
+		}}
+	})
+
+	Describe("Rendering the packer variables", func() {
+		Context("without overrides", func() {
+			It("should use the release and target from the spec", func() {
+				variables := renderConfig(img)
+				Expect(variables["kubernetes_semver"]).To(Equal("v1.23.8"))
+				Expect(variables["build_name"]).To(Equal("windows-2019"))
+				Expect(variables["windows_image_index"]).To(Equal("3"))
+				Expect(variables["os_iso_path"]).To(Equal("[sharedVmfs-0] ./win.iso"))
+				Expect(variables["vcenter_server"]).To(Equal("10.0.0.1"))
+				Expect(variables["insecure_connection"]).To(Equal("false"))
+				Expect(variables["kubernetes_base_url"]).To(Equal("http://10.0.0.10:30008/files/kubernetes/"))
+			})
+			It("should keep the datastore and folder of datastore paths", func() {
+				img.Spec.VMToolsPath = "[isoVmfs-0] isos/./vmtools.iso"
+				variables := renderConfig(img)
+				Expect(variables["os_iso_path"]).To(Equal("[sharedVmfs-0] ./win.iso"))
+				Expect(variables["vmtools_iso_path"]).To(Equal("[isoVmfs-0] ./isos/vmtools.iso"))
+			})
+		})
+		Context("with reserved overrides", func() {
+			It("should list the variables set by the controller", func() {
+				Expect(windows.ReservedVariables(
+					map[string]string{"vcenter_server": "10.0.0.2", "prepull": "true", "folder": "images"},
+					map[string]string{"build_name": "custom", "vcenter_server": "10.0.0.3"},
+				)).To(Equal([]string{"build_name", "vcenter_server"}))
+				Expect(windows.ReservedVariables(map[string]string{"unattend_timezone": "UTC"}, nil)).To(BeEmpty())
+			})
+		})
+		Context("with overrides", func() {
+			It("should apply the last override on top of the defaults", func() {
+				variables := renderConfig(img,
+					map[string]string{"unattend_timezone": "UTC", "prepull": "true"},
+					map[string]string{"prepull": "false", "custom_role": "true"},
+				)
+				Expect(variables["unattend_timezone"]).To(Equal("UTC"))
+				Expect(variables["prepull"]).To(Equal("false"))
+				Expect(variables["custom_role"]).To(Equal("true"))
+			})
+		})
+	})
+})
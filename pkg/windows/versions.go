@@ -0,0 +1,49 @@
+package windows
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultKubernetesVersion is the Kubernetes semver used when the spec does not set one.
+const DefaultKubernetesVersion = "v1.23.8"
+
+// KubernetesRelease holds the artifacts shipped by a windows-resource-bundle release
+type KubernetesRelease struct {
+	KubernetesVersion string
+	BundleImage       string
+	ContainerdFile    string
+	ContainerdHash    string
+}
+
+// releases maps the supported Kubernetes semver to its TKG resource bundle, new
+// entries must be added when a windows-resource-bundle is published. The image tag,
+// containerd file and its sha256 come from the windows-resource-bundle component
+// of the TKG release BOM, Packer rejects the containerd file on a hash mismatch.
+var releases = map[string]KubernetesRelease{
+	"v1.23.8": {
+		KubernetesVersion: "v1.23.8",
+		BundleImage:       "projects.registry.vmware.com/tkg/windows-resource-bundle:v1.23.8_vmware.2-tkg.1",
+		ContainerdFile:    "cri-containerd-v1.6.6+vmware.2.windows-amd64.tar",
+		ContainerdHash:    "a5348e2e7cc63194c2bb4575dd3c414a26c829380e72a81c3dc2d12454f67fcd",
+	},
+}
+
+// GetKubernetesRelease returns the release artifacts for a Kubernetes semver
+func GetKubernetesRelease(version string) (*KubernetesRelease, error) {
+	release, ok := releases[version]
+	if !ok {
+		return nil, fmt.Errorf("kubernetes version %q is not supported, use one of: %v", version, SupportedKubernetesVersions())
+	}
+	return &release, nil
+}
+
+// SupportedKubernetesVersions returns the sorted list of known Kubernetes semver
+func SupportedKubernetesVersions() []string {
+	versions := make([]string, 0, len(releases))
+	for v := range releases {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
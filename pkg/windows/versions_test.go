@@ -0,0 +1,29 @@
+package windows_test
+
+import (
+	"sort"
+
+	"github.com/knabben/tkw/pkg/windows"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Kubernetes releases", func() {
+	It("should return the resource bundle of a supported version", func() {
+		release, err := windows.GetKubernetesRelease(windows.DefaultKubernetesVersion)
+		Expect(err).To(BeNil())
+		Expect(release.KubernetesVersion).To(Equal(windows.DefaultKubernetesVersion))
+		Expect(release.BundleImage).To(HaveSuffix(":v1.23.8_vmware.2-tkg.1"))
+	})
+
+	It("should reject an unknown version with the supported ones", func() {
+		_, err := windows.GetKubernetesRelease("v1.0.0")
+		Expect(err).To(MatchError(`kubernetes version "v1.0.0" is not supported, use one of: [v1.23.8]`))
+	})
+
+	It("should sort the supported versions", func() {
+		versions := windows.SupportedKubernetesVersions()
+		Expect(versions).To(ContainElement(windows.DefaultKubernetesVersion))
+		Expect(sort.StringsAreSorted(versions)).To(BeTrue())
+	})
+})